@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// adaptiveGrowAfter is the number of consecutive fast calculations after
+// which intervalSizer doubles the interval width.
+const adaptiveGrowAfter = 3
+
+// intervalSizer adapts the width of intervals to spectraplot's feedback
+// when spectraplot.adaptive.enabled is set. The width is halved after
+// alerts asking for a smaller range and after timeouts, and doubled after
+// adaptiveGrowAfter calculations faster than spectraplot.adaptive.fastCalc_s
+// in a row, staying within spectraplot.adaptive.minRange and maxRange.
+// It is shared among workers.
+type intervalSizer struct {
+	mu       sync.Mutex
+	width    float64
+	min, max float64
+	fast     time.Duration
+	streak   int
+}
+
+// newIntervalSizer returns a sizer starting at width within the configured bounds.
+func newIntervalSizer(width float64) *intervalSizer {
+	s := &intervalSizer{
+		min:  viper.GetFloat64("spectraplot.adaptive.minRange"),
+		max:  viper.GetFloat64("spectraplot.adaptive.maxRange"),
+		fast: time.Duration(viper.GetFloat64("spectraplot.adaptive.fastCalc_s") * float64(time.Second)),
+	}
+	s.width = s.clamp(width)
+	return s
+}
+
+func (s *intervalSizer) clamp(width float64) float64 {
+	return math.Max(s.min, math.Min(s.max, width))
+}
+
+// size returns the width of the next intervals.
+func (s *intervalSizer) size() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.width
+}
+
+// observe adapts the width to the calculation of interval taking d and
+// failing with err. Feedback on intervals narrower than the current width
+// is only used to shrink it, so in-flight intervals do not halve it twice.
+func (s *intervalSizer) observe(interval [2]float64, d time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	width := interval[1] - interval[0]
+	switch {
+	case shrinksRange(err) || errors.Is(err, ErrTimeout):
+		s.streak = 0
+		if half := s.clamp(width / 2); half < s.width {
+			logf("[inf] %s. shrinking intervals to %g cm-1", err, half)
+			s.width = half
+		}
+	case err != nil:
+	case d < s.fast && width >= s.width:
+		s.streak++
+		if s.streak < adaptiveGrowAfter {
+			break
+		}
+		s.streak = 0
+		if grown := s.clamp(s.width * 2); grown > s.width {
+			logf("[inf] fast calculations. growing intervals to %g cm-1", grown)
+			s.width = grown
+		}
+	default:
+		s.streak = 0
+	}
+}
+
+// adaptiveMeta returns the segments metadata of an output file holding
+// intervals on adaptive crawls, whose interval widths vary. Other crawls
+// write none.
+func adaptiveMeta(intervals [][2]float64) []string {
+	if !viper.GetBool("spectraplot.adaptive.enabled") {
+		return nil
+	}
+	return []string{segmentsMeta(intervals)}
+}
+
+// retryMinRange returns the smallest interval [cm-1] retries split down
+// to, spectraplot.adaptive.minRange on adaptive crawls.
+func retryMinRange() float64 {
+	if min := viper.GetFloat64("spectraplot.adaptive.minRange"); viper.GetBool("spectraplot.adaptive.enabled") && min > 0 {
+		return min
+	}
+	return minRetryRange
+}
+
+// checkAdaptiveConfig validates the bounds of adaptive interval sizing.
+func checkAdaptiveConfig() error {
+	if !viper.GetBool("spectraplot.adaptive.enabled") {
+		return nil
+	}
+	min, max := viper.GetFloat64("spectraplot.adaptive.minRange"), viper.GetFloat64("spectraplot.adaptive.maxRange")
+	if min <= 0 || max < min {
+		return fmt.Errorf("spectraplot.adaptive: expected 0 < minRange <= maxRange. got minRange=%g, maxRange=%g", min, max)
+	}
+	if viper.GetFloat64("spectraplot.adaptive.fastCalc_s") <= 0 {
+		return fmt.Errorf("spectraplot.adaptive.fastCalc_s must be positive")
+	}
+	return nil
+}
+
+// crawlAdaptive crawls nuStart-nuEnd for c in rounds of a batch per driver,
+// cutting each round into intervals as wide as the sizer currently allows.
+// Ranges recorded done in the manifest are skipped so that crawls can be
+// rerun to resume.
+func crawlAdaptive(ctx context.Context, drivers []SpectraplotDriver, m *manifest, c spectraConditions, nuStart, nuEnd float64) error {
+	if nuStart > nuEnd {
+		nuStart, nuEnd = nuEnd, nuStart
+	}
+	job := conditionString(c)
+	sizer := newIntervalSizer(gasMaxRange(c.species()))
+	perRound := len(drivers) * viper.GetInt("spectraplot.maxNumberOfPlots")
+	if perRound < 1 {
+		perRound = 1
+	}
+	for nu := nuStart; nu < nuEnd-1; {
+		var round [][2]float64
+		for len(round) < perRound && nu < nuEnd-1 {
+			if end, ok := m.doneFrom(job, nu); ok {
+				nu = end
+				continue
+			}
+			end := math.Min(nu+sizer.size(), nuEnd)
+			round = append(round, [2]float64{nu, end})
+			nu = end
+		}
+		if len(round) == 0 {
+			break
+		}
+		if err := crawlIntervals(ctx, drivers, m, c, round, sizer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestIntervalSizer(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("log.silent", true)
+	s := &intervalSizer{width: 100, min: 20, max: 400, fast: time.Second}
+	tooBig := newAlertError("toobigDiv", "", true)
+	s.observe([2]float64{0, 100}, time.Second, tooBig)
+	if s.size() != 50 {
+		t.Fatalf("expected width halved to 50, got %g", s.size())
+	}
+	// an in-flight interval of the old width does not halve it again.
+	s.observe([2]float64{100, 200}, 10*time.Second, ErrTimeout)
+	if s.size() != 50 {
+		t.Fatalf("expected width kept at 50, got %g", s.size())
+	}
+	for i := 0; i < adaptiveGrowAfter-1; i++ {
+		s.observe([2]float64{0, 50}, time.Millisecond, nil)
+	}
+	s.observe([2]float64{0, 50}, 2*time.Second, nil) // slow calculation resets the streak.
+	for i := 0; i < adaptiveGrowAfter; i++ {
+		s.observe([2]float64{0, 50}, time.Millisecond, nil)
+	}
+	if s.size() != 100 {
+		t.Fatalf("expected width doubled to 100 after fast calculations, got %g", s.size())
+	}
+	s.observe([2]float64{0, 30}, time.Second, ErrTimeout)
+	if s.size() != 20 {
+		t.Errorf("expected width clamped to minRange 20, got %g", s.size())
+	}
+}
+
+func TestAdaptiveOutput(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	intervals := [][2]float64{{1000, 1100}, {1100, 1150}}
+	if meta := adaptiveMeta(intervals); meta != nil || retryMinRange() != minRetryRange {
+		t.Errorf("expected no segments and retries split to %g without adaptive sizing, got %v, %g", minRetryRange, meta, retryMinRange())
+	}
+	viper.Set("spectraplot.adaptive.enabled", true)
+	viper.Set("spectraplot.adaptive.minRange", 25.0)
+	if meta := adaptiveMeta(intervals); len(meta) != 1 || meta[0] != "segments=1000-1100;1100-1150" {
+		t.Errorf("expected segments of adaptive crawl, got %v", meta)
+	}
+	if retryMinRange() != 25 {
+		t.Errorf("expected retries split down to adaptive.minRange 25, got %g", retryMinRange())
+	}
+}
+
+func TestCrawlAdaptive(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	viper.Set("spectraplot.adaptive.enabled", true)
+	viper.Set("spectraplot.adaptive.minRange", 25.0)
+	viper.Set("spectraplot.adaptive.maxRange", 400.0)
+	viper.Set("spectraplot.adaptive.fastCalc_s", 10.0)
+	d := &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// intervals grow to 200 cm-1 after the first three fast calculations.
+	var got []string
+	for _, c := range d.Calculated {
+		got = append(got, segmentsMeta([][2]float64{{c.NuStart, c.NuEnd}}))
+	}
+	want := "segments=1000-1100 segments=1100-1200 segments=1200-1300 segments=1300-1500 segments=1500-1600"
+	if strings.Join(got, " ") != want {
+		t.Errorf("expected calculations %s, got %s", want, strings.Join(got, " "))
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}
+	fo, err := os.Open(outDir + fpsep + generateFilename(c, [2]float64{1300, 1600}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fo.Close()
+	header, err := csv.NewReader(fo).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(header[1], "/segments=1300-1500;1500-1600/") {
+		t.Errorf("expected segmentation in header, got %q", header[1])
+	}
+	// crawling again skips the range recorded done in the manifest.
+	d = &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Calculated) != 0 {
+		t.Errorf("expected done range skipped, got %d calculations", len(d.Calculated))
+	}
+}
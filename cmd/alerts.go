@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors of spectraplot's alert divs, matched by AlertError with errors.Is.
+var (
+	ErrRangeTooBig  = fmt.Errorf("spectracrawl: simulation range too big")
+	ErrTooManyLines = fmt.Errorf("spectracrawl: too many lines in simulation window")
+	ErrLinesReduced = fmt.Errorf("spectracrawl: not all lines plotted")
+	ErrMoleFraction = fmt.Errorf("spectracrawl: mole fraction not less than 1")
+	ErrSimRange     = fmt.Errorf("spectracrawl: big simulation range")
+	ErrNotInfrared  = fmt.Errorf("spectracrawl: wavelength too short for infrared lines")
+	ErrN2Pathlength = fmt.Errorf("spectracrawl: N2 weakly infrared active at short pathlength")
+)
+
+// spectraplotAlerts are the alert divs of the absorption page by id with the
+// error each stands for and the text shown. Alerts that do not fail the
+// calculation are warnings and only logged. reduceLinesDiv is a warning:
+// the lines plotted are kept, as with the Linestrength cutoff.
+var spectraplotAlerts = map[string]struct {
+	err   error
+	fails bool
+	text  string
+}{
+	"alertDiv":         {ErrDanger, true, "Sorry! Something went wrong with the calculation!"},
+	"timeoutDiv":       {ErrTimeout, true, "Sorry! Your simulation took too long. Reduce your simulation range or increase Δν."},
+	"toobigDiv":        {ErrRangeTooBig, true, "Your simulation range is too big, Sorry! We can only simulate 3000 cm-1 at a time."},
+	"toobigAbsEmisDiv": {ErrRangeTooBig, true, "Your simulation range is too big, Sorry! We can only simulate 100 cm-1 at a time."},
+	"badspecies":       {ErrTooManyLines, true, "HITEMP CO2 and H2O have a lot of lines! Please reduce your simulation window to less than 1000 cm-1."},
+	"reduceLinesDiv":   {ErrLinesReduced, false, "Not all of your lines were plotted, sorry! Either reduce your simulation window or increase the Linestrength cutoff."},
+	"molefracDiv":      {ErrMoleFraction, true, "Every mole fraction must be less than 1!"},
+	"simrangeDiv":      {ErrSimRange, false, "You're simulating a big range."},
+	"notinfraredDiv":   {ErrNotInfrared, false, "Your wavelength is quite short!"},
+	"n2hitran":         {ErrN2Pathlength, false, "It looks like you're simulating N2 with a relatively short pathlength."},
+}
+
+// AlertError is an alert div shown by spectraplot on calculating. It
+// matches the error of its alert with errors.Is, and ErrDanger if the
+// calculation failed.
+type AlertError struct {
+	// ID is the id of the alert div, i.e. toobigDiv.
+	ID string
+	// Text is the message of the alert.
+	Text string
+	// danger is set for alert-danger divs. It decides whether alerts
+	// missing from spectraplotAlerts fail the calculation.
+	danger bool
+}
+
+// newAlertError returns the error of the alert div id showing text. The
+// known text of the alert is used if text is empty.
+func newAlertError(id, text string, danger bool) *AlertError {
+	if text == "" {
+		text = spectraplotAlerts[id].text
+	}
+	return &AlertError{ID: id, Text: text, danger: danger}
+}
+
+func (e *AlertError) Error() string {
+	return fmt.Sprintf("spectracrawl: %s alert: %s", e.ID, e.Text)
+}
+
+func (e *AlertError) Unwrap() error { return spectraplotAlerts[e.ID].err }
+
+func (e *AlertError) Is(target error) bool {
+	return target == ErrDanger && e.fails()
+}
+
+// fails reports whether the calculation was abandoned for the alert.
+func (e *AlertError) fails() bool {
+	if alert, ok := spectraplotAlerts[e.ID]; ok {
+		return alert.fails
+	}
+	return e.danger
+}
+
+// shrinksRange reports whether err is an alert asking for a smaller
+// simulation window, in which case intervals are split on retry.
+func shrinksRange(err error) bool {
+	return errors.Is(err, ErrRangeTooBig) || errors.Is(err, ErrTooManyLines)
+}
+
+// alertText returns the message of an alert div's text without its close button.
+func alertText(text string) string {
+	text = strings.TrimSpace(text)
+	text = strings.TrimSpace(strings.TrimPrefix(text, "×"))
+	text = strings.TrimSpace(strings.TrimPrefix(text, "Close"))
+	return strings.Join(strings.Fields(text), " ")
+}
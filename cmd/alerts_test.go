@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	wd "github.com/fedesog/webdriver"
+	"github.com/spf13/viper"
+)
+
+func TestAlertError(t *testing.T) {
+	for _, test := range []struct {
+		id     string
+		danger bool
+		is     error
+		fails  bool
+	}{
+		{"alertDiv", true, ErrDanger, true},
+		{"timeoutDiv", false, ErrTimeout, true},
+		{"toobigDiv", true, ErrRangeTooBig, true},
+		{"toobigAbsEmisDiv", true, ErrRangeTooBig, true},
+		{"badspecies", true, ErrTooManyLines, true},
+		{"reduceLinesDiv", false, ErrLinesReduced, false},
+		{"molefracDiv", true, ErrMoleFraction, true},
+		{"simrangeDiv", false, ErrSimRange, false},
+		{"notinfraredDiv", false, ErrNotInfrared, false},
+		{"n2hitran", false, ErrN2Pathlength, false},
+		{"newDangerDiv", true, ErrDanger, true},
+	} {
+		var err error = newAlertError(test.id, "", test.danger)
+		if !errors.Is(err, test.is) {
+			t.Errorf("%s: expected error to be %v", test.id, test.is)
+		}
+		if errors.Is(err, ErrDanger) != test.fails {
+			t.Errorf("%s: expected ErrDanger match %v", test.id, test.fails)
+		}
+	}
+	err := newAlertError("toobigDiv", "", true)
+	if !strings.Contains(err.Error(), "3000 cm-1") {
+		t.Errorf("expected alert text in %q", err)
+	}
+	if !shrinksRange(err) || shrinksRange(newAlertError("molefracDiv", "", true)) {
+		t.Error("expected only range alerts to shrink the range")
+	}
+}
+
+// fakeSession is a page with a calculate button and alert divs, where
+// alerts are shown once after the given number of lookups. As on
+// spectraplot, shown alerts stay displayed until closed.
+type fakeSession struct {
+	button  *fakeElement
+	alerts  []*fakeElement
+	showAt  int
+	lookups int
+	shown   bool
+}
+
+func (s *fakeSession) Url(string) error { return nil }
+
+func (s *fakeSession) FindElement(_ wd.FindElementStrategy, _ string) (pageElement, error) {
+	return s.button, nil
+}
+
+func (s *fakeSession) FindElements(_ wd.FindElementStrategy, _ string) ([]pageElement, error) {
+	s.lookups++
+	var elems []pageElement
+	for _, e := range s.alerts {
+		if s.lookups >= s.showAt && !s.shown {
+			e.attrs["style"] = "display: block;"
+		}
+		elems = append(elems, e)
+	}
+	s.shown = s.shown || s.lookups >= s.showAt
+	return elems, nil
+}
+
+func (s *fakeSession) CloseCurrentWindow() error { return nil }
+func (s *fakeSession) Delete() error             { return nil }
+
+type fakeElement struct {
+	text     string
+	attrs    map[string]string
+	children []pageElement
+	onClick  func()
+}
+
+func (e *fakeElement) FindElements(wd.FindElementStrategy, string) ([]pageElement, error) {
+	return e.children, nil
+}
+func (e *fakeElement) Click() error {
+	if e.onClick != nil {
+		e.onClick()
+	}
+	return nil
+}
+func (e *fakeElement) Text() (string, error)                    { return e.text, nil }
+func (e *fakeElement) Clear() error                             { return nil }
+func (e *fakeElement) SendKeys(string) error                    { return nil }
+func (e *fakeElement) GetAttribute(name string) (string, error) { return e.attrs[name], nil }
+
+// fakeAlert returns an alert div hidden by clicking its close button.
+func fakeAlert(id, class, text string) *fakeElement {
+	alert := &fakeElement{text: "×\nClose\n" + text, attrs: map[string]string{
+		"id": id, "class": "alert alert-" + class + " alert-dismissible", "style": "display: none;"}}
+	alert.children = []pageElement{&fakeElement{onClick: func() { alert.attrs["style"] = "display: none;" }}}
+	return alert
+}
+
+func TestWaitForCalculationAlerts(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("log.silent", true)
+	viper.Set("spectraplot.calcTimeout_s", 5)
+	// the alert shows up after the calculation started.
+	s := &fakeSession{button: &fakeElement{text: "Calculating..."}, showAt: 3, alerts: []*fakeElement{
+		fakeAlert("n2hitran", "warning", "It looks like you're simulating N2."),
+		fakeAlert("toobigDiv", "danger", "Your simulation range is too big, Sorry!"),
+	}}
+	err := waitForCalculation(context.Background(), s, "#calculate_hitran")
+	var alert *AlertError
+	if !errors.As(err, &alert) || alert.ID != "toobigDiv" || alert.Text != "Your simulation range is too big, Sorry!" {
+		t.Fatalf("expected toobigDiv alert error, got %v", err)
+	}
+	if !errors.Is(err, ErrRangeTooBig) {
+		t.Errorf("expected ErrRangeTooBig, got %v", err)
+	}
+	// warnings alone do not fail the calculation.
+	s = &fakeSession{button: &fakeElement{text: "Calculate"}, alerts: []*fakeElement{
+		fakeAlert("n2hitran", "warning", "It looks like you're simulating N2."),
+		fakeAlert("reduceLinesDiv", "warning", "Not all of your lines were plotted, sorry!"),
+	}}
+	if err = waitForCalculation(context.Background(), s, "#calculate_hitran"); err != nil {
+		t.Errorf("expected n2hitran and reduceLinesDiv warnings to be logged only, got %v", err)
+	}
+}
+
+func TestAlertClosedBeforeNextCalculation(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("log.silent", true)
+	viper.Set("spectraplot.calcTimeout_s", 5)
+	s := &fakeSession{button: &fakeElement{text: "Calculate"}, alerts: []*fakeElement{
+		fakeAlert("timeoutDiv", "danger", "Sorry! Your simulation took too long."),
+	}}
+	if err := waitForCalculation(context.Background(), s, "#calculate_hitran"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected timeoutDiv alert error, got %v", err)
+	}
+	if stl := s.alerts[0].attrs["style"]; alertShown(stl) {
+		t.Fatalf("expected alert closed after reading it, got style %q", stl)
+	}
+	if err := waitForCalculation(context.Background(), s, "#calculate_hitran"); err != nil {
+		t.Errorf("expected calculation after alert to succeed, got %v", err)
+	}
+}
+
+func TestCrawlRangeTooBig(t *testing.T) {
+	setCrawlConfig(t)
+	viper.Set("spectraplot.retries", 1)
+	d := &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{nil, newAlertError("toobigDiv", "", true)}}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// the interval too big is retried in halves without spectraplot.retrySplit
+	// while the one cleared along with it is retried whole.
+	if len(d.Calculated) != 5+3 {
+		t.Errorf("expected 8 calculations, got %d", len(d.Calculated))
+	}
+	m, err := loadManifest(manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := conditionString(spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, NuStep: 0.1, gasID: "CH4"})
+	if chunk := m.chunk(job, [2]float64{1100, 1200}); chunk.Status != chunkSplit {
+		t.Errorf("expected chunk too big to be split, got %+v", chunk)
+	}
+	if chunk := m.chunk(job, [2]float64{1000, 1100}); chunk.Status != chunkDone {
+		t.Errorf("expected cleared chunk done after retry, got %+v", chunk)
+	}
+}
+
+func TestCrawlMoleFraction(t *testing.T) {
+	setCrawlConfig(t)
+	viper.Set("spectraplot.retries", 3)
+	d := &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{newAlertError("molefracDiv", "", true)}}
+	if err := crawl(context.Background(), d); !errors.Is(err, ErrMoleFraction) {
+		t.Fatalf("expected crawl to fail fast with ErrMoleFraction, got %v", err)
+	}
+	if d.calcs != 1 {
+		t.Errorf("expected a single calculation attempt, got %d", d.calcs)
+	}
+}
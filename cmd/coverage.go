@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	coverageCovered    = "covered"
+	coverageDuplicated = "duplicated"
+	coverageMissing    = "missing"
+)
+
+// coverageSegment is a wavenumber sub-range covered by len(Files) output files.
+type coverageSegment struct {
+	NuStart, NuEnd float64
+	Status         string
+	Files          []string `json:",omitempty"`
+}
+
+// coverageReport is the coverage of the requested wavenumber span for
+// output files sharing the same spectra conditions.
+type coverageReport struct {
+	Conditions                   string
+	NuStart, NuEnd               float64
+	Covered, Duplicated, Missing float64 // [cm-1]
+	Segments                     []coverageSegment
+}
+
+// spectraFile is an output file with the wavenumber span, conditions and
+// quantity parsed from its name as written by generateFilename.
+type spectraFile struct {
+	name       string
+	interval   [2]float64
+	conditions spectraConditions
+	quantity   string
+}
+
+// parseSpectraFilename parses a filename written by generateFilename,
+// i.e. nu=1000-1300,CH4,x=1e-06,T=300K,P=1atm,L=100cm.csv
+func parseSpectraFilename(name string) (f spectraFile, err error) {
+	if !strings.HasPrefix(name, "nu=") || !strings.HasSuffix(name, ".csv") {
+		return f, fmt.Errorf("not a spectracrawl output file: %s", name)
+	}
+	fields := strings.Split(strings.TrimSuffix(name, ".csv"), ",")
+	span := strings.SplitN(strings.TrimPrefix(fields[0], "nu="), "-", 2)
+	if len(span) != 2 {
+		return f, fmt.Errorf("bad wavenumber span in %s", name)
+	}
+	for i := range span {
+		f.interval[i], err = strconv.ParseFloat(span[i], 64)
+		if err != nil {
+			return f, fmt.Errorf("bad wavenumber span in %s. %s", name, err)
+		}
+	}
+	f.conditions, err = parseSpectraConditions(fields[1:])
+	if err != nil {
+		return f, err
+	}
+	f.name = name
+	f.quantity = quantityAbsorbance
+	for _, field := range fields[1:] {
+		if strings.HasPrefix(field, "quantity=") {
+			f.quantity = strings.TrimPrefix(field, "quantity=")
+		}
+	}
+	return f, nil
+}
+
+// spectraCoverage groups the output files in dir by conditions and quantity
+// and computes the coverage of nuStart-nuEnd for each group. Conditions are
+// compared as parsed so that i.e. x=1e-06 and x=1e-6 share a group.
+func spectraCoverage(dir string, nuStart, nuEnd float64) ([]coverageReport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]spectraFile)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), "nu=") {
+			continue
+		}
+		f, err := parseSpectraFilename(e.Name())
+		if err != nil {
+			logf("[warn] skipping %s. %s", e.Name(), err)
+			continue
+		}
+		key := conditionString(f.conditions)
+		if f.quantity != quantityAbsorbance {
+			key += "/quantity=" + f.quantity
+		}
+		groups[key] = append(groups[key], f)
+	}
+	var reports []coverageReport
+	for key, files := range groups {
+		reports = append(reports, coverageOf(key, files, nuStart, nuEnd))
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Conditions < reports[j].Conditions })
+	return reports, nil
+}
+
+// coverageOf splits nuStart-nuEnd into segments covered by none,
+// one or several of files.
+func coverageOf(key string, files []spectraFile, nuStart, nuEnd float64) coverageReport {
+	if nuStart > nuEnd {
+		nuStart, nuEnd = nuEnd, nuStart
+	}
+	r := coverageReport{Conditions: key, NuStart: nuStart, NuEnd: nuEnd}
+	bounds := []float64{nuStart, nuEnd}
+	for _, f := range files {
+		for _, nu := range f.interval {
+			if nu > nuStart && nu < nuEnd {
+				bounds = append(bounds, nu)
+			}
+		}
+	}
+	sort.Float64s(bounds)
+	for i := 1; i < len(bounds); i++ {
+		seg := coverageSegment{NuStart: bounds[i-1], NuEnd: bounds[i]}
+		if seg.NuEnd == seg.NuStart {
+			continue
+		}
+		for _, f := range files {
+			if f.interval[0] <= seg.NuStart && f.interval[1] >= seg.NuEnd {
+				seg.Files = append(seg.Files, f.name)
+			}
+		}
+		switch len(seg.Files) {
+		case 0:
+			seg.Status = coverageMissing
+		case 1:
+			seg.Status = coverageCovered
+		default:
+			seg.Status = coverageDuplicated
+		}
+		width := seg.NuEnd - seg.NuStart
+		switch seg.Status {
+		case coverageMissing:
+			r.Missing += width
+		case coverageCovered:
+			r.Covered += width
+		case coverageDuplicated:
+			r.Duplicated += width
+		}
+		if last := len(r.Segments) - 1; last >= 0 && r.Segments[last].Status == seg.Status && sameFiles(r.Segments[last].Files, seg.Files) {
+			r.Segments[last].NuEnd = seg.NuEnd
+			continue
+		}
+		r.Segments = append(r.Segments, seg)
+	}
+	return r
+}
+
+func sameFiles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var coverageJSON string
+
+var coverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "Reports covered, duplicated and missing wavenumber ranges in output.dir",
+	Long: `Reports covered, duplicated and missing wavenumber ranges in output.dir
+
+Output file names are parsed for their wavenumber span and conditions.
+Files with different conditions are reported separately. The span
+checked is startNu to endNu of the HITRAN and NIST config sections.
+Every gas of their gasID is checked in its own output directory.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		applyOverrides()
+		var reports []coverageReport
+		for _, section := range configuredSections() {
+			err := inSection(section, func() error {
+				sectionReports, err := configCoverage()
+				reports = append(reports, sectionReports...)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		printCoverage(os.Stdout, reports)
+		if coverageJSON == "" {
+			return nil
+		}
+		b, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(coverageJSON, b, 0644)
+	},
+}
+
+// configCoverage returns the coverage of the output directories of the
+// configSection gases.
+func configCoverage() (reports []coverageReport, err error) {
+	nuStart, nuEnd := configNuSpan()
+	gases, err := gasIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, gas := range gases {
+		dir := outputDirFor(gas)
+		gasReports, err := spectraCoverage(dir, nuStart, nuEnd)
+		if err != nil {
+			return nil, err
+		}
+		if len(gasReports) == 0 {
+			logf("[inf] no output files found in %s", dir)
+		}
+		reports = append(reports, gasReports...)
+	}
+	return reports, nil
+}
+
+func printCoverage(w io.Writer, reports []coverageReport) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s\tnu=[%.f-%.f]\tcovered=%.f\tduplicated=%.f\tmissing=%.f\n",
+			r.Conditions, r.NuStart, r.NuEnd, r.Covered, r.Duplicated, r.Missing)
+		for _, seg := range r.Segments {
+			fmt.Fprintf(tw, "\t%.f-%.f\t%s\t%s\n", seg.NuStart, seg.NuEnd, seg.Status, strings.Join(seg.Files, " "))
+		}
+	}
+	_ = tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(coverageCmd)
+	coverageCmd.Flags().StringVar(&coverageJSON, "json", "", "write coverage report as JSON to file")
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSpectraCoverage(t *testing.T) {
+	dir := t.TempDir()
+	ch4 := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}
+	co2 := spectraConditions{T: 300, P: 1, L: 100, Ppm: 400, gasID: "CO2"}
+	for _, name := range []string{
+		generateFilename(ch4, [2]float64{1000, 1300}),
+		generateFilename(ch4, [2]float64{1200, 1400}),
+		// Same conditions as written by hand, x formatted differently.
+		"nu=1500-1600,CH4,x=1e-6,T=300K,P=1atm,L=100cm.csv",
+		generateFilename(co2, [2]float64{1000, 1600}),
+		defaultManifestName,
+	} {
+		if err := os.WriteFile(dir+fpsep+name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reports, err := spectraCoverage(dir, 1000, 1600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 condition groups, got %d", len(reports))
+	}
+	r := reports[0]
+	if r.Covered != 400 || r.Duplicated != 100 || r.Missing != 100 {
+		t.Errorf("unexpected CH4 coverage %+v", r)
+	}
+	expected := []coverageSegment{
+		{NuStart: 1000, NuEnd: 1200, Status: coverageCovered},
+		{NuStart: 1200, NuEnd: 1300, Status: coverageDuplicated},
+		{NuStart: 1300, NuEnd: 1400, Status: coverageCovered},
+		{NuStart: 1400, NuEnd: 1500, Status: coverageMissing},
+		{NuStart: 1500, NuEnd: 1600, Status: coverageCovered},
+	}
+	if len(r.Segments) != len(expected) {
+		t.Fatalf("expected %d segments, got %+v", len(expected), r.Segments)
+	}
+	for i, seg := range expected {
+		got := r.Segments[i]
+		if got.NuStart != seg.NuStart || got.NuEnd != seg.NuEnd || got.Status != seg.Status {
+			t.Errorf("segment %d: expected %+v, got %+v", i, seg, got)
+		}
+	}
+	if reports[1].Covered != 600 || reports[1].Missing != 0 {
+		t.Errorf("unexpected CO2 coverage %+v", reports[1])
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import "context"
+
+// SpectraplotDriver drives a spectraplot absorption page. Implementations
+// must keep calculated plots until Clear is called so that a batch of
+// intervals is exported in a single Download.
+type SpectraplotDriver interface {
+	// SetConditions fills the form with the temperature, pressure, path length,
+	// mole fraction and wavenumber span of c. Returns ErrPageScan if the form
+	// is not found.
+	SetConditions(c spectraConditions) error
+	// SelectSpecies picks gasID of database from the species menu of
+	// slot 1-3. An empty database selects the HITRAN entry.
+	SelectSpecies(slot int, gasID, database string) error
+	// Calculate plots the current form and waits for the result. Returns
+	// ErrTimeout or ErrDanger on failed calculations and ctx.Err() if ctx
+	// is done while waiting.
+	Calculate(ctx context.Context) error
+	// Download exports all current plots and returns the path to the
+	// downloaded spectraplot zip.
+	Download(ctx context.Context) (string, error)
+	// Clear removes all plots.
+	Clear() error
+	// Reload navigates to the spectraplot page again.
+	Reload() error
+	// Close ends the browsing session.
+	Close() error
+}
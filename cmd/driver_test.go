@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// setCrawlConfig configures a small CH4 crawl of nu=1000-1600 with output
+// into a temporary directory which is returned.
+func setCrawlConfig(t *testing.T) string {
+	t.Helper()
+	t.Cleanup(viper.Reset)
+	outDir := t.TempDir()
+	for k, v := range map[string]interface{}{
+		"HITRAN.gasID":                 "CH4",
+		"HITRAN.T":                     300.0,
+		"HITRAN.p":                     1.0,
+		"HITRAN.L":                     100.0,
+		"HITRAN.ppm":                   1.0,
+		"HITRAN.startNu":               1000.0,
+		"HITRAN.endNu":                 1600.0,
+		"HITRAN.stepNu":                0.1,
+		"spectraplot.maxNumberOfPlots": 3,
+		"spectraplot.maxRange":         100.0,
+		"output.dir":                   outDir,
+		"log.silent":                   true,
+	} {
+		viper.Set(k, v)
+	}
+	return outDir
+}
+
+func TestCrawlFakeDriver(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	d := &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Calculated) != 6 {
+		t.Errorf("expected 6 calculations, got %d", len(d.Calculated))
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}
+	for _, interval := range [][2]float64{{1000, 1300}, {1300, 1600}} {
+		name := generateFilename(c, interval)
+		if _, err := os.Stat(outDir + fpsep + name); err != nil {
+			t.Errorf("expected output %s. %s", name, err)
+		}
+	}
+	// second crawl should skip existing files.
+	d = &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Calculated) != 0 {
+		t.Errorf("expected existing files to be skipped, got %d calculations", len(d.Calculated))
+	}
+}
+
+func TestCrawlFakeDriverTimeout(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	d := &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{nil, ErrTimeout}}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}
+	if _, err := os.Stat(outDir + fpsep + generateFilename(c, [2]float64{1000, 1300})); !os.IsNotExist(err) {
+		t.Error("expected timed out batch to not produce a full file")
+	}
+}
+
+func TestCrawlRetrySplit(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	viper.Set("spectraplot.retries", 1)
+	viper.Set("spectraplot.retrySplit", true)
+	d := &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{nil, ErrDanger}}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// 5 of 6 intervals calculate and the 2 dropped ones are retried in halves.
+	if len(d.Calculated) != 5+4 {
+		t.Errorf("expected 9 calculations, got %d", len(d.Calculated))
+	}
+	m, err := loadManifest(manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, NuStep: 0.1, gasID: "CH4"}
+	job := conditionString(c)
+	if left := m.unfinished(job); len(left) != 0 {
+		t.Errorf("expected no unfinished intervals after retry, got %v", left)
+	}
+	if chunk := m.chunk(job, [2]float64{1000, 1100}); chunk.Status != chunkSplit {
+		t.Errorf("expected dropped chunk to be split, got %+v", chunk)
+	}
+	for _, interval := range [][2]float64{{1000, 1150}, {1150, 1200}} {
+		if _, err := os.Stat(outDir + fpsep + generateFilename(c, interval)); err != nil {
+			t.Errorf("expected retried output. %s", err)
+		}
+	}
+}
+
+func TestCrawlWorkers(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	viper.Set("HITRAN.endNu", 1900.0)
+	drivers := []*fakeDriver{{Dir: t.TempDir()}, {Dir: t.TempDir()}}
+	if err := crawl(context.Background(), drivers[0], drivers[1]); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(drivers[0].Calculated) + len(drivers[1].Calculated); n != 9 {
+		t.Errorf("expected 9 calculations among workers, got %d", n)
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}
+	for _, interval := range [][2]float64{{1000, 1300}, {1300, 1600}, {1600, 1900}} {
+		if _, err := os.Stat(outDir + fpsep + generateFilename(c, interval)); err != nil {
+			t.Errorf("expected output. %s", err)
+		}
+	}
+}
+
+func TestCrawlFormMismatch(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	viper.Set("spectraplot.retries", 1)
+	d := &fakeDriver{Dir: t.TempDir(), SetErrs: []error{nil, ErrFormMismatch}}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// the mismatched batch is discarded whole and requeued.
+	if len(d.Calculated) != 6+1 {
+		t.Errorf("expected 7 calculations, got %d", len(d.Calculated))
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}
+	for _, interval := range [][2]float64{{1000, 1300}, {1300, 1600}} {
+		if _, err := os.Stat(outDir + fpsep + generateFilename(c, interval)); err != nil {
+			t.Errorf("expected output after requeue. %s", err)
+		}
+	}
+}
+
+func TestCrawlInterrupt(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// interrupted after the first interval of the second batch.
+	d := &fakeDriver{Dir: t.TempDir(), Cancel: cancel, CancelAfter: 4}
+	if err := crawl(ctx, d); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, NuStep: 0.1, gasID: "CH4"}
+	if _, err := os.Stat(outDir + fpsep + generateFilename(c, [2]float64{1000, 1300})); err != nil {
+		t.Errorf("expected batch finished before interrupt. %s", err)
+	}
+	m, err := loadManifest(manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := conditionString(c)
+	for _, interval := range m.unfinished(job) {
+		if chunk := m.chunk(job, interval); chunk.Status != chunkPending || chunk.Attempts != 0 {
+			t.Errorf("expected abandoned chunk left pending, got %+v", chunk)
+		}
+	}
+	if left := m.unfinished(job); len(left) != 3 {
+		t.Fatalf("expected 3 unfinished intervals, got %v", left)
+	}
+	d = &fakeDriver{Dir: t.TempDir()}
+	if err = crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Calculated) != 3 {
+		t.Errorf("expected only abandoned batch recalculated, got %d calculations", len(d.Calculated))
+	}
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// fakeDriver is an in-memory SpectraplotDriver that plots synthetic spectra
+// and writes them to Dir on Download. It lets the crawl scheduling be
+// exercised without a browser.
+type fakeDriver struct {
+	// Dir is where the spectraplot zip is written on Download.
+	Dir string
+	// CalcErrs are returned by successive calls to Calculate. Calculations
+	// past the end of CalcErrs succeed.
+	CalcErrs []error
+	// SetErrs are returned by successive calls to SetConditions, i.e.
+	// ErrFormMismatch for a form ignoring typed values.
+	SetErrs []error
+	// DownloadErrs are returned by successive calls to Download, i.e.
+	// ErrTimeout for a download that never shows up.
+	DownloadErrs []error
+	// Cancel is called once CancelAfter calculations are made, i.e. to
+	// interrupt a crawl midway.
+	Cancel      context.CancelFunc
+	CancelAfter int
+	// Calculated records the conditions of every successful calculation.
+	Calculated []spectraConditions
+
+	conditions spectraConditions
+	// selected holds the species picked in each slot.
+	selected  [mixtureSlots]string
+	plots     []plotLine
+	calcs     int
+	sets      int
+	downloads int
+	closed    bool
+}
+
+func (f *fakeDriver) SetConditions(c spectraConditions) error {
+	if f.closed {
+		return ErrPageScan
+	}
+	f.sets++
+	if f.sets <= len(f.SetErrs) && f.SetErrs[f.sets-1] != nil {
+		return f.SetErrs[f.sets-1]
+	}
+	f.conditions = c
+	return nil
+}
+
+func (f *fakeDriver) SelectSpecies(slot int, gasID, database string) error {
+	if slot < 1 || slot > mixtureSlots {
+		return fmt.Errorf("no species slot %d", slot)
+	}
+	f.selected[slot-1] = spectraConditions{gasID: gasID, database: database}.species()
+	return nil
+}
+
+func (f *fakeDriver) Calculate(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.calcs++
+	if f.Cancel != nil && f.calcs == f.CancelAfter {
+		defer f.Cancel()
+	}
+	if f.calcs <= len(f.CalcErrs) && f.CalcErrs[f.calcs-1] != nil {
+		return f.CalcErrs[f.calcs-1]
+	}
+	if f.conditions.NuStep <= 0 || f.conditions.NuEnd <= f.conditions.NuStart {
+		return ErrDanger
+	}
+	for i, s := range f.conditions.slots() {
+		if f.selected[i] != s.species() {
+			return ErrDanger // species in form does not match conditions
+		}
+	}
+	f.plots = append(f.plots, syntheticSpectrum(f.conditions))
+	f.Calculated = append(f.Calculated, f.conditions)
+	return nil
+}
+
+func (f *fakeDriver) Download(ctx context.Context) (string, error) {
+	f.downloads++
+	if f.downloads <= len(f.DownloadErrs) && f.DownloadErrs[f.downloads-1] != nil {
+		return "", f.DownloadErrs[f.downloads-1]
+	}
+	if len(f.plots) == 0 {
+		return "", fmt.Errorf("no plots to download")
+	}
+	name := f.Dir + fpsep + defaultZipName
+	fo, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	defer fo.Close()
+	return name, writeSpectraZip(fo, f.plots)
+}
+
+func (f *fakeDriver) Clear() error {
+	f.plots = f.plots[:0]
+	return nil
+}
+
+func (f *fakeDriver) Reload() error {
+	f.plots = f.plots[:0]
+	f.conditions = spectraConditions{}
+	f.selected = [mixtureSlots]string{}
+	return nil
+}
+
+func (f *fakeDriver) Close() error {
+	f.closed = true
+	return nil
+}
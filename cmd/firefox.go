@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+
+	wd "github.com/fedesog/webdriver"
+	"github.com/spf13/cast"
+)
+
+// Browsers selected with browser.type.
+const (
+	browserChrome  = "chrome"
+	browserFirefox = "firefox"
+)
+
+const (
+	// geckoDriverPort is the port of the first worker's geckodriver.
+	geckoDriverPort = 4444
+	// geckoDriverStartTimeout is how long geckodriver has to start listening.
+	geckoDriverStartTimeout = 10 * time.Second
+)
+
+// geckoDriver is a local geckodriver process. webdriver's FirefoxDriver
+// drives Firefox through a legacy extension current Firefox releases no
+// longer load, so sessions are opened with the W3C client instead.
+type geckoDriver struct {
+	cmd *exec.Cmd
+	url string
+}
+
+// startGeckoDriver starts the geckodriver binary at path listening on port
+// and waits for it to answer.
+func startGeckoDriver(path string, port int) (*geckoDriver, error) {
+	cmd := exec.Command(path, "--port", strconv.Itoa(port))
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	g := &geckoDriver{cmd: cmd, url: fmt.Sprintf("http://127.0.0.1:%d", port)}
+	deadline := time.Now().Add(geckoDriverStartTimeout)
+	for {
+		resp, err := http.Get(g.url + "/status")
+		if err == nil {
+			resp.Body.Close()
+			return g, nil
+		}
+		if time.Now().After(deadline) {
+			_ = g.Stop()
+			return nil, fmt.Errorf("geckodriver not answering on %s. %s", g.url, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Stop kills the geckodriver process.
+func (g *geckoDriver) Stop() error {
+	if err := g.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	_ = g.cmd.Wait()
+	return nil
+}
+
+// firefoxCapabilities returns browser.capabilities with moz:firefoxOptions
+// set from browser.headless, browser.args and browser.binary, saving zip
+// downloads into downloadDir without asking unless it is empty.
+func firefoxCapabilities(downloadDir string) (wd.Capabilities, error) {
+	caps, options, err := configCapabilities("moz:firefoxOptions", "-headless")
+	if err != nil {
+		return nil, err
+	}
+	if downloadDir != "" {
+		prefs := copyMap(cast.ToStringMap(options["prefs"]))
+		prefs["browser.download.folderList"] = 2 // use browser.download.dir
+		prefs["browser.download.dir"] = downloadDir
+		prefs["browser.download.useDownloadDir"] = true
+		prefs["browser.download.manager.showWhenStarting"] = false
+		prefs["browser.helperApps.neverAsk.saveToDisk"] = "application/zip,application/x-zip-compressed,application/octet-stream"
+		options["prefs"] = prefs
+	}
+	caps["moz:firefoxOptions"] = options
+	if caps["browserName"] == nil {
+		caps["browserName"] = browserFirefox
+	}
+	return caps, nil
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultLogFile is written when log.toFile is set without log.file.
+const defaultLogFile = "spectracrawl.log"
+
+// logger is set up from the log config section by setupLogging. Until then
+// log events go to stdout as text unless log.silent is set.
+var logger *slog.Logger
+
+var logFile *os.File
+
+// setupLogging creates the logger writing to stdout, unless log.silent is
+// set, and to log.file if given or log.toFile is set. log.format selects
+// text or json output and log.level the lowest level logged.
+func setupLogging() error {
+	var writers []io.Writer
+	if !viper.GetBool("log.silent") {
+		writers = append(writers, stdoutWriter{})
+	}
+	path := viper.GetString("log.file")
+	if path == "" && viper.GetBool("log.toFile") {
+		path = defaultLogFile
+	}
+	if path != "" {
+		fo, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		logFile = fo
+		writers = append(writers, fo)
+	}
+	h, err := newLogHandler(io.MultiWriter(writers...))
+	if err != nil {
+		closeLog()
+		return err
+	}
+	logger = slog.New(h)
+	return nil
+}
+
+// newLogHandler returns a handler writing log.format records of at least
+// log.level to w.
+func newLogHandler(w io.Writer) (slog.Handler, error) {
+	var level slog.Level
+	if s := viper.GetString("log.level"); s != "" {
+		if err := level.UnmarshalText([]byte(s)); err != nil {
+			return nil, fmt.Errorf("log.level: expected debug, info, warn or error. got %q", s)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch format := strings.ToLower(viper.GetString("log.format")); format {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("log.format: expected text or json. got %q", format)
+	}
+}
+
+// closeLog closes the log file, if any.
+func closeLog() {
+	if logFile != nil {
+		_ = logFile.Close()
+		logFile = nil
+	}
+}
+
+func currentLogger() *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	w := io.Writer(stdoutWriter{})
+	if viper.GetBool("log.silent") {
+		w = io.Discard
+	}
+	return slog.New(slog.NewTextHandler(w, nil))
+}
+
+// logLevels maps the level prefixes of log messages, i.e. [warn], to levels.
+var logLevels = map[string]slog.Level{
+	"dbg":  slog.LevelDebug,
+	"inf":  slog.LevelInfo,
+	"scp":  slog.LevelInfo,
+	"warn": slog.LevelWarn,
+	"err":  slog.LevelError,
+}
+
+// splitLevel splits the level prefix off msg. Messages without one are
+// logged at info level.
+func splitLevel(msg string) (slog.Level, string) {
+	if strings.HasPrefix(msg, "[") {
+		if i := strings.Index(msg, "]"); i > 0 {
+			if lvl, ok := logLevels[msg[1:i]]; ok {
+				return lvl, strings.TrimSpace(msg[i+1:])
+			}
+		}
+	}
+	return slog.LevelInfo, msg
+}
+
+// logEvent logs msg at level lvl with key-value pairs args as fields.
+func logEvent(lvl slog.Level, msg string, args ...interface{}) {
+	currentLogger().Log(context.Background(), lvl, msg, args...)
+}
+
+func log(args ...interface{}) {
+	logf("%s", args...)
+}
+
+// logf logs the formatted message at the level of its prefix, i.e.
+// logf("[warn] %s", err).
+func logf(format string, args ...interface{}) {
+	var msg string
+	if len(args) == 0 {
+		msg = format
+	} else {
+		msg = fmt.Sprintf(format, args...)
+	}
+	lvl, msg := splitLevel(strings.TrimSuffix(msg, "\n"))
+	logEvent(lvl, msg)
+}
+
+// jobFields returns the fields of a job event over interval of the crawl
+// of c, so crawl logs can be filtered by gas, conditions and interval.
+func jobFields(c spectraConditions, interval [2]float64, attempt int, d time.Duration) []interface{} {
+	return []interface{}{
+		"gas", c.species(),
+		"T", c.T,
+		"P", c.P,
+		"L", c.L,
+		"nuStart", interval[0],
+		"nuEnd", interval[1],
+		"attempt", attempt,
+		"duration", d,
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSplitLevel(t *testing.T) {
+	for _, test := range []struct {
+		msg, want string
+		level     slog.Level
+	}{
+		{"[inf] start program", "start program", slog.LevelInfo},
+		{"[warn] closing browser session", "closing browser session", slog.LevelWarn},
+		{"[err] error in config", "error in config", slog.LevelError},
+		{"[scp] calculated", "calculated", slog.LevelInfo},
+		{"no prefix", "no prefix", slog.LevelInfo},
+		{"[CH4] not a level", "[CH4] not a level", slog.LevelInfo},
+	} {
+		level, msg := splitLevel(test.msg)
+		if level != test.level || msg != test.want {
+			t.Errorf("splitLevel(%q) = %v, %q. want %v, %q", test.msg, level, msg, test.level, test.want)
+		}
+	}
+}
+
+func TestJobLogFields(t *testing.T) {
+	setCrawlConfig(t)
+	viper.Set("log.format", "json")
+	var buf bytes.Buffer
+	h, err := newLogHandler(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger = slog.New(h)
+	t.Cleanup(func() { logger = nil })
+	if err := crawl(context.Background(), &fakeDriver{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	downloads := 0
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var event map[string]interface{}
+		if err := dec.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		if event["msg"] != "file downloaded" {
+			continue
+		}
+		downloads++
+		for _, key := range []string{"gas", "T", "P", "L", "nuStart", "nuEnd", "attempt", "duration"} {
+			if _, ok := event[key]; !ok {
+				t.Errorf("expected %s field in %v", key, event)
+			}
+		}
+		if event["gas"] != "CH4" || event["attempt"] != 1.0 {
+			t.Errorf("unexpected job fields %v", event)
+		}
+	}
+	if downloads != 2 {
+		t.Errorf("expected 2 file downloaded events, got %d", downloads)
+	}
+}
+
+func TestSetupLoggingFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { logger = nil })
+	path := filepath.Join(t.TempDir(), "crawl.log")
+	viper.Set("log.silent", true)
+	viper.Set("log.file", path)
+	viper.Set("log.level", "warn")
+	if err := setupLogging(); err != nil {
+		t.Fatal(err)
+	}
+	log("[inf] not logged")
+	logf("[warn] logged %d", 1)
+	closeLog()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("not logged")) || !bytes.Contains(b, []byte(`level=WARN msg="logged 1"`)) {
+		t.Errorf("unexpected log file contents %q", b)
+	}
+	viper.Set("log.format", "xml")
+	if err := setupLogging(); err == nil {
+		t.Error("expected error for unknown log.format")
+	}
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const defaultManifestName = "spectracrawl.manifest.json"
+
+// manifestSaveInterval is the least time between saves of the manifest
+// during a crawl. Crawls save it on returning regardless.
+var manifestSaveInterval = 5 * time.Second
+
+const (
+	chunkPending = "pending"
+	chunkDone    = "done"
+	chunkFailed  = "failed"
+	// chunkSplit chunks were replaced by two halves on retry.
+	chunkSplit = "split"
+)
+
+// manifestChunk records the crawl state of a single nuIntervals interval.
+type manifestChunk struct {
+	// Job identifies the spectra conditions of the chunk, i.e. CH4/x=1e-6/T=300K/P=1atm/L=100cm.
+	Job       string
+	NuStart   float64
+	NuEnd     float64
+	Status    string
+	Attempts  int
+	LastError string `json:",omitempty"`
+	// File is the output file in the gas's output directory holding the chunk's spectrum.
+	File string `json:",omitempty"`
+	// err is the error of the last attempt in this run, nil once resumed.
+	err error
+}
+
+func (c *manifestChunk) markDone(file string) {
+	c.Status, c.File, c.LastError, c.err = chunkDone, file, "", nil
+}
+
+func (c *manifestChunk) markFailed(err error) {
+	c.Status, c.LastError, c.err = chunkFailed, err.Error(), err
+}
+
+// manifest is the persistent record of a crawl. It is saved as JSON
+// so that interrupted or failed crawls can be resumed.
+type manifest struct {
+	path   string
+	Chunks []*manifestChunk
+	// index holds Chunks by job and NuStart.
+	index map[string]map[float64][]*manifestChunk
+	// saved is when the manifest was last saved.
+	saved time.Time
+}
+
+// manifestPath returns output.manifest or the default manifest file in the
+// output directory. A single manifest is shared by all gases of a crawl.
+func manifestPath() string {
+	if path := viper.GetString("output.manifest"); path != "" {
+		return sanitizePath(path)
+	}
+	if gases, _ := gasIDs(); len(gases) == 1 {
+		return outputDirFor(gases[0]) + fpsep + defaultManifestName
+	}
+	return outputBaseDir() + fpsep + defaultManifestName
+}
+
+// loadManifest reads the manifest at path. A missing file yields an empty manifest.
+func loadManifest(path string) (*manifest, error) {
+	m := &manifest{path: path}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("corrupt manifest %s. %s", path, err)
+	}
+	for _, c := range m.Chunks {
+		m.indexChunk(c)
+	}
+	return m, nil
+}
+
+func (m *manifest) indexChunk(c *manifestChunk) {
+	if m.index == nil {
+		m.index = make(map[string]map[float64][]*manifestChunk)
+	}
+	starts := m.index[c.Job]
+	if starts == nil {
+		starts = make(map[float64][]*manifestChunk)
+		m.index[c.Job] = starts
+	}
+	starts[c.NuStart] = append(starts[c.NuStart], c)
+}
+
+// save writes the manifest to a temporary file and renames it so that
+// a crash never leaves a truncated manifest behind.
+func (m *manifest) save() error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	m.saved = time.Now()
+	return os.Rename(tmp, m.path)
+}
+
+// saveEvery saves the manifest if it was last saved more than d ago so that
+// long crawls do not rewrite it after every batch.
+func (m *manifest) saveEvery(d time.Duration) error {
+	if time.Since(m.saved) < d {
+		return nil
+	}
+	return m.save()
+}
+
+// chunk returns the chunk of job spanning interval, adding a pending
+// chunk if not present.
+func (m *manifest) chunk(job string, interval [2]float64) *manifestChunk {
+	for _, c := range m.index[job][interval[0]] {
+		if c.NuEnd == interval[1] {
+			return c
+		}
+	}
+	c := &manifestChunk{Job: job, NuStart: interval[0], NuEnd: interval[1], Status: chunkPending}
+	m.Chunks = append(m.Chunks, c)
+	m.indexChunk(c)
+	return c
+}
+
+// doneFrom returns the end of a done chunk of job starting at nu.
+func (m *manifest) doneFrom(job string, nu float64) (end float64, ok bool) {
+	for _, c := range m.index[job][nu] {
+		if c.Status == chunkDone && c.NuEnd > end {
+			end, ok = c.NuEnd, true
+		}
+	}
+	return end, ok
+}
+
+// unfinished returns the intervals of job which are pending or failed.
+func (m *manifest) unfinished(job string) (intervals [][2]float64) {
+	for _, c := range m.Chunks {
+		if c.Job == job && (c.Status == chunkPending || c.Status == chunkFailed) {
+			intervals = append(intervals, [2]float64{c.NuStart, c.NuEnd})
+		}
+	}
+	return intervals
+}
+
+// unfinishedJobs returns the jobs with pending or failed intervals in the
+// order first recorded.
+func (m *manifest) unfinishedJobs() (jobs []string) {
+	seen := make(map[string]bool)
+	for _, c := range m.Chunks {
+		if !seen[c.Job] && (c.Status == chunkPending || c.Status == chunkFailed) {
+			seen[c.Job] = true
+			jobs = append(jobs, c.Job)
+		}
+	}
+	return jobs
+}
+
+// jobDatabase returns the line database of job as written by
+// conditionString, empty for HITRAN.
+func jobDatabase(job string) string {
+	gas := strings.SplitN(job, "/", 2)[0]
+	if i := strings.LastIndex(gas, " "); i >= 0 {
+		return gas[i+1:]
+	}
+	return ""
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Retries unfinished or failed intervals recorded in the manifest",
+	Long: `Retries unfinished or failed intervals recorded in the manifest
+
+Every crawl records the state of each interval in a manifest
+(output.manifest, default is output.dir/` + defaultManifestName + `).
+resume retries only the intervals left pending or failed
+by a previous crawl with the same conditions. Jobs are resumed
+with the HITRAN or NIST config section of their database.
+`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		allSections = true
+		return configArgs(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCommand(cmd, "[inf] resuming crawl", resumer)
+	},
+}
+
+func resumer(ctx context.Context) error { return resume(ctx, startWebDrivers) }
+
+// resume crawls the unfinished intervals in the manifests of the configured
+// sections with drivers started by start once there is something to resume.
+func resume(ctx context.Context, start func() ([]SpectraplotDriver, error)) error {
+	var drivers []SpectraplotDriver
+	defer func() { closeDrivers(drivers) }()
+	defer startProgress().finish()
+	loaded := make(map[string]bool)
+	for _, section := range configuredSections() {
+		var path string
+		_ = inSection(section, func() error { path = manifestPath(); return nil })
+		if loaded[path] {
+			continue // manifest shared by sections.
+		}
+		loaded[path] = true
+		m, err := loadManifest(path)
+		if err != nil {
+			return err
+		}
+		jobs := m.unfinishedJobs()
+		if len(jobs) == 0 {
+			logf("[inf] nothing to resume in %s", m.path)
+			continue
+		}
+		for _, job := range jobs {
+			err = inSection(sectionOf(jobDatabase(job)), func() error {
+				c, ok, err := configJob(job)
+				if err != nil {
+					return err
+				} else if !ok {
+					logf("[warn] %s unfinished in %s but not in %s config section. skipping", job, m.path, configSection)
+					return nil
+				}
+				intervals := m.unfinished(job)
+				logf("[inf] resuming %d unfinished intervals for %s", len(intervals), job)
+				if drivers == nil {
+					if drivers, err = start(); err != nil {
+						return err
+					}
+				}
+				var sizer *intervalSizer
+				if viper.GetBool("spectraplot.adaptive.enabled") {
+					sizer = newIntervalSizer(gasMaxRange(c.species()))
+				}
+				return crawlIntervals(ctx, drivers, m, c, intervals, sizer)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// configJob returns the crawl job of configSection with condition string job.
+func configJob(job string) (spectraConditions, bool, error) {
+	jobs, err := crawlJobs()
+	if err != nil {
+		return spectraConditions{}, false, err
+	}
+	for _, c := range jobs {
+		if conditionString(c) == job {
+			return c, true, nil
+		}
+	}
+	return spectraConditions{}, false, nil
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+}
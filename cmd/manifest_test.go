@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestManifestResume(t *testing.T) {
+	setCrawlConfig(t)
+	d := &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{nil, ErrTimeout}}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := crawlJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := jobs[0]
+	job := conditionString(c)
+	if len(m.Chunks) != 6 {
+		t.Fatalf("expected 6 chunks in manifest, got %d", len(m.Chunks))
+	}
+	unfinished := m.unfinished(job)
+	// first interval is dropped along with the timed out second one.
+	if len(unfinished) != 2 || unfinished[0] != [2]float64{1000, 1100} || unfinished[1] != [2]float64{1100, 1200} {
+		t.Fatalf("expected intervals 1000-1200 unfinished, got %v", unfinished)
+	}
+	if c := m.chunk(job, [2]float64{1100, 1200}); c.Status != chunkFailed || c.LastError != ErrTimeout.Error() || c.Attempts != 1 {
+		t.Errorf("unexpected timed out chunk %+v", c)
+	}
+	d = &fakeDriver{Dir: t.TempDir()}
+	if err = crawlIntervals(context.Background(), []SpectraplotDriver{d}, m, c, unfinished, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Calculated) != 2 {
+		t.Errorf("expected only unfinished intervals recalculated, got %d", len(d.Calculated))
+	}
+	m, err = loadManifest(manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := m.unfinished(job); len(left) != 0 {
+		t.Errorf("expected no unfinished intervals after resume, got %v", left)
+	}
+}
+
+func TestResumeNist(t *testing.T) {
+	setCrawlConfig(t)
+	for k, v := range map[string]interface{}{
+		"NIST.gasID":   "Na",
+		"NIST.Telec":   1000.0,
+		"NIST.T":       300.0,
+		"NIST.p":       1.0,
+		"NIST.L":       1.0,
+		"NIST.ppm":     0.1,
+		"NIST.startNu": 16900.0,
+		"NIST.endNu":   17100.0,
+		"NIST.stepNu":  0.01,
+	} {
+		viper.Set(k, v)
+	}
+	var job string
+	err := inSection(nistSection, func() error {
+		d := &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{nil, ErrTimeout}}
+		jobs, err := crawlJobs()
+		if err != nil {
+			return err
+		}
+		job = conditionString(jobs[0])
+		return crawl(context.Background(), d)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db := jobDatabase(job); db != dbNIST {
+		t.Fatalf("expected %s database of job %s, got %q", dbNIST, job, db)
+	}
+	start := func() ([]SpectraplotDriver, error) {
+		return []SpectraplotDriver{&fakeDriver{Dir: t.TempDir()}}, nil
+	}
+	// resume runs from the HITRAN section and picks NIST for the NIST job.
+	if err = resume(context.Background(), start); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := m.unfinished(job); len(left) != 0 {
+		t.Errorf("expected NIST job resumed, got %v unfinished", left)
+	}
+}
+
+func TestResumeAdaptive(t *testing.T) {
+	setCrawlConfig(t)
+	d := &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{nil, ErrTimeout}}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("spectraplot.adaptive.enabled", true)
+	viper.Set("spectraplot.adaptive.minRange", 25.0)
+	viper.Set("spectraplot.adaptive.maxRange", 400.0)
+	viper.Set("spectraplot.adaptive.fastCalc_s", 10.0)
+	viper.Set("spectraplot.retries", 1)
+	start := func() ([]SpectraplotDriver, error) {
+		return []SpectraplotDriver{&fakeDriver{Dir: t.TempDir(), CalcErrs: []error{ErrTimeout}}}, nil
+	}
+	if err := resume(context.Background(), start); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(manifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := conditionString(spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, NuStep: 0.1, gasID: "CH4"})
+	// resumed intervals timing out are split as on adaptive crawls.
+	if chunk := m.chunk(job, [2]float64{1000, 1100}); chunk.Status != chunkSplit {
+		t.Errorf("expected timed out chunk split on resume, got %+v", chunk)
+	}
+	if left := m.unfinished(job); len(left) != 0 {
+		t.Errorf("expected no unfinished intervals after resume, got %v", left)
+	}
+}
+
+func TestManifestSaveEvery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), defaultManifestName)
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.chunk("CH4", [2]float64{1000, 1100}).markDone("a.csv")
+	m.chunk("CH4", [2]float64{1000, 1050})
+	if err = m.saveEvery(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// the first save is not held back.
+	if _, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	m.chunk("CH4", [2]float64{1100, 1200})
+	if err = m.saveEvery(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Chunks) != 2 {
+		t.Fatalf("expected save within an hour of the last held back, got %d chunks", len(saved.Chunks))
+	}
+	if err = m.save(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err = loadManifest(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Chunks) != 3 || saved.chunk("CH4", [2]float64{1000, 1100}).Status != chunkDone {
+		t.Errorf("unexpected saved chunks %+v", saved.Chunks)
+	}
+	if end, ok := saved.doneFrom("CH4", 1000); !ok || end != 1100 {
+		t.Errorf("expected 1000-1100 done, got end %g, %v", end, ok)
+	}
+}
+
+func TestBatchIntervals(t *testing.T) {
+	intervals := [][2]float64{{0, 1}, {1, 2}, {2, 3}, {3, 4}, {6, 7}, {7, 8}}
+	batches := batchIntervals(intervals, 3)
+	if len(batches) != 3 || len(batches[0]) != 3 || len(batches[1]) != 1 || len(batches[2]) != 2 {
+		t.Errorf("unexpected batches %v", batches)
+	}
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Prometheus metrics served at /metrics of metrics.listen. They are written
+// in the Prometheus text format so no client library is needed.
+var (
+	intervalsAttempted = &counter{name: "spectracrawl_intervals_attempted_total",
+		help: "Intervals whose calculation was attempted."}
+	intervalsSucceeded = &counter{name: "spectracrawl_intervals_succeeded_total",
+		help: "Intervals calculated, downloaded and written to file."}
+	intervalErrors = &counter{name: "spectracrawl_interval_errors_total",
+		help:  "Intervals failed by reason.",
+		label: "reason", labelValues: []string{reasonTimeout, reasonDanger, reasonPageScan, reasonNoData}}
+	calcWaitSeconds = &histogram{name: "spectracrawl_calculation_wait_seconds",
+		help: "Time waited for spectraplot calculations.", buckets: waitBuckets}
+	downloadWaitSeconds = &histogram{name: "spectracrawl_download_wait_seconds",
+		help: "Time waited for spectra downloads.", buckets: waitBuckets}
+)
+
+// Values of the reason label of intervalErrors.
+const (
+	reasonTimeout  = "timeout"
+	reasonDanger   = "danger"
+	reasonPageScan = "page_scan"
+	reasonNoData   = "no_data"
+)
+
+// waitBuckets are the histogram upper bounds [s] of calculation and download waits.
+var waitBuckets = []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120}
+
+var registry = []interface{ write(w io.Writer) }{
+	intervalsAttempted, intervalsSucceeded, intervalErrors, calcWaitSeconds, downloadWaitSeconds,
+}
+
+// countErr counts n intervals failed with a crawl error. Other errors are
+// not counted.
+func countErr(err error, n int) {
+	switch {
+	case errors.Is(err, ErrTimeout), err == ErrDownloadTimeout:
+		intervalErrors.add(n, reasonTimeout)
+	case errors.Is(err, ErrDanger):
+		intervalErrors.add(n, reasonDanger)
+	case err == ErrPageScan:
+		intervalErrors.add(n, reasonPageScan)
+	case err == ErrNoData:
+		intervalErrors.add(n, reasonNoData)
+	}
+}
+
+// counter is a Prometheus counter, optionally with a single label.
+type counter struct {
+	name, help string
+	label      string
+	// labelValues are written even before being counted.
+	labelValues []string
+	mu          sync.Mutex
+	values      map[string]uint64
+}
+
+// add adds n to the counter of labelValue, which is omitted for unlabeled counters.
+func (c *counter) add(n int, labelValue ...string) {
+	var v string
+	if len(labelValue) > 0 {
+		v = labelValue[0]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]uint64)
+	}
+	c.values[v] += uint64(n)
+}
+
+// value returns the count of labelValue.
+func (c *counter) value(labelValue ...string) uint64 {
+	var v string
+	if len(labelValue) > 0 {
+		v = labelValue[0]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[v]
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if c.label == "" {
+		fmt.Fprintf(w, "%s %d\n", c.name, c.values[""])
+		return
+	}
+	values := append([]string(nil), c.labelValues...)
+	for v := range c.values {
+		if !contains(c.labelValues, v) {
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	for _, v := range values {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", c.name, c.label, v, c.values[v])
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// histogram is a Prometheus histogram of durations in seconds.
+type histogram struct {
+	name, help string
+	buckets    []float64
+	mu         sync.Mutex
+	counts     []uint64 // per bucket, not cumulative.
+	sum        float64
+	count      uint64
+}
+
+// observeSince observes the time elapsed since start.
+func (h *histogram) observeSince(start time.Time) {
+	h.observe(time.Since(start).Seconds())
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(h.buckets))
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	var cumulative uint64
+	for i, le := range h.buckets {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// metricsHandler serves the registry in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range registry {
+		m.write(w)
+	}
+}
+
+// serveMetrics serves /metrics at addr until the returned server is closed.
+func serveMetrics(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics.listen: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	srv := &http.Server{Handler: mux}
+	go func() { _ = srv.Serve(ln) }()
+	logf("[inf] serving metrics at http://%s/metrics", ln.Addr())
+	return srv, nil
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestCrawlMetrics(t *testing.T) {
+	setCrawlConfig(t)
+	attempted, succeeded := intervalsAttempted.value(), intervalsSucceeded.value()
+	timeouts, noData := intervalErrors.value(reasonTimeout), intervalErrors.value(reasonNoData)
+	d := &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{nil, ErrTimeout}}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// the first interval is dropped along with the timed out second one.
+	if n := intervalsAttempted.value() - attempted; n != 6 {
+		t.Errorf("expected 6 intervals attempted, got %d", n)
+	}
+	if n := intervalsSucceeded.value() - succeeded; n != 4 {
+		t.Errorf("expected 4 intervals succeeded, got %d", n)
+	}
+	if n := intervalErrors.value(reasonTimeout) - timeouts; n != 1 {
+		t.Errorf("expected 1 interval timed out, got %d", n)
+	}
+	if n := intervalErrors.value(reasonNoData) - noData; n != 0 {
+		t.Errorf("expected no intervals without data, got %d", n)
+	}
+}
+
+func TestCrawlMetricsReasons(t *testing.T) {
+	setCrawlConfig(t)
+	timeouts, danger := intervalErrors.value(reasonTimeout), intervalErrors.value(reasonDanger)
+	d := &fakeDriver{Dir: t.TempDir(), DownloadErrs: []error{ErrTimeout}}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if n := intervalErrors.value(reasonTimeout) - timeouts; n != 3 {
+		t.Errorf("expected the 3 intervals of the timed out download counted as timeout, got %d", n)
+	}
+	d = &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{newAlertError("molefracDiv", "", true)}}
+	if err := crawl(context.Background(), d); !errors.Is(err, ErrMoleFraction) {
+		t.Fatalf("expected ErrMoleFraction, got %v", err)
+	}
+	if n := intervalErrors.value(reasonDanger) - danger; n != 3 {
+		t.Errorf("expected the 3 intervals of the batch counted as danger, got %d", n)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("output.timeout_s", 5)
+	name := filepath.Join(t.TempDir(), "spectra.zip")
+	if err := os.WriteFile(name, []byte("PK"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForDownload(context.Background(), name); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(metricsHandler))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(b)
+	for _, want := range []string{
+		"# TYPE spectracrawl_intervals_attempted_total counter",
+		`spectracrawl_interval_errors_total{reason="danger"}`,
+		`spectracrawl_interval_errors_total{reason="page_scan"}`,
+		"# TYPE spectracrawl_calculation_wait_seconds histogram",
+		`spectracrawl_download_wait_seconds_bucket{le="0.5"} `,
+		`spectracrawl_download_wait_seconds_bucket{le="+Inf"} `,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, body)
+		}
+	}
+	if downloadWaitSeconds.count == 0 {
+		t.Error("expected download wait observed")
+	}
+}
+
+func TestRunCommandClosesMetrics(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("log.silent", true)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	viper.Set("metrics.listen", addr)
+	errCrawl := errors.New("crawl failed")
+	err = runCommand(&cobra.Command{}, "[inf] test", func(ctx context.Context) error {
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			t.Errorf("expected metrics served during command. %s", err)
+			return errCrawl
+		}
+		resp.Body.Close()
+		return errCrawl
+	})
+	if le, ok := err.(loggedError); !ok || le.error != errCrawl {
+		t.Fatalf("expected logged crawl error returned, got %v", err)
+	}
+	// the metrics server is closed on return instead of exiting.
+	if resp, err := http.Get("http://" + addr + "/metrics"); err == nil {
+		resp.Body.Close()
+		t.Error("expected metrics server closed after command")
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := &histogram{name: "wait_seconds", buckets: []float64{1, 5}}
+	for _, v := range []float64{0.5, 1, 3, 10} {
+		h.observe(v)
+	}
+	var sb strings.Builder
+	h.write(&sb)
+	for _, want := range []string{
+		`wait_seconds_bucket{le="1"} 2`,
+		`wait_seconds_bucket{le="5"} 3`,
+		`wait_seconds_bucket{le="+Inf"} 4`,
+		"wait_seconds_sum 14.5",
+		"wait_seconds_count 4",
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, sb.String())
+		}
+	}
+}
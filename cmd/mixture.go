@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// mixtureSlots is the number of species pickers on the HITRAN tab.
+const mixtureSlots = 3
+
+// mixtureSep joins the species and mole fractions of a mixture in labels
+// and filenames, i.e. H2O_CO2_CH4,x=0.02_0.0004_1.9e-06. Gas IDs such as
+// NO+ rule out joining with a plus sign.
+const mixtureSep = "_"
+
+// hitranSpecies are the gases listed under HITRAN 2012 in the species menu.
+var hitranSpecies = []string{
+	"CH3Cl", "CH3CN", "CH3OH", "CH4", "CO", "CO2", "COF2", "C2H2", "C2H4", "C2H6", "ClO",
+	"HCOOH", "HCN", "HBr", "HCl", "HF", "HI", "HNO3", "HOBr", "HOCl", "H2O", "H2O2", "H2CO", "H2S",
+	"NH3", "NO", "NO2", "NO+", "N2", "N2O", "O", "O2", "O3", "OCS", "OH", "PH3", "SO2",
+}
+
+// mixtureSpecies is a species filling one of the species slots.
+type mixtureSpecies struct {
+	gasID, database string
+	Ppm             float64
+}
+
+func (s mixtureSpecies) species() string {
+	return spectraConditions{gasID: s.gasID, database: s.database}.species()
+}
+
+// slots returns the species of c in slot order. This is c.mixture for
+// mixtures and the single species of c otherwise.
+func (c spectraConditions) slots() []mixtureSpecies {
+	if len(c.mixture) > 0 {
+		return c.mixture
+	}
+	return []mixtureSpecies{{gasID: c.gasID, database: c.database, Ppm: c.Ppm}}
+}
+
+// components returns the single species conditions of every species of
+// the mixture c at its mole fraction in the mixture.
+func (c spectraConditions) components() []spectraConditions {
+	components := make([]spectraConditions, len(c.mixture))
+	for i, s := range c.mixture {
+		components[i] = c
+		components[i].mixture = nil
+		components[i].gasID, components[i].database, components[i].Ppm = s.gasID, s.database, s.Ppm
+	}
+	return components
+}
+
+// mixtureName joins the species of a mixture, i.e. H2O_CO2_CH4.
+func mixtureName(mix []mixtureSpecies) string {
+	names := make([]string, len(mix))
+	for i, s := range mix {
+		names[i] = s.species()
+	}
+	return strings.Join(names, mixtureSep)
+}
+
+// parseMixtureName returns the species of a mixture name without mole
+// fractions. It returns nil if name is not a mixture.
+func parseMixtureName(name string) (mix []mixtureSpecies) {
+	if !strings.Contains(name, mixtureSep) {
+		return nil
+	}
+	for _, species := range strings.Split(name, mixtureSep) {
+		var s mixtureSpecies
+		s.gasID, s.database = parseSpecies(species)
+		mix = append(mix, s)
+	}
+	return mix
+}
+
+// parseMixtureFractions sets the mole fractions of mix from x as written
+// in labels and filenames, i.e. 0.02_0.0004.
+func parseMixtureFractions(mix []mixtureSpecies, x string) error {
+	fractions := strings.Split(x, mixtureSep)
+	if len(fractions) != len(mix) {
+		return fmt.Errorf("expected %d mole fractions for mixture %s. got %s", len(mix), mixtureName(mix), x)
+	}
+	for i := range mix {
+		f, err := strconv.ParseFloat(fractions[i], 64)
+		if err != nil {
+			return err
+		}
+		mix[i].Ppm = f * 1e6
+	}
+	return nil
+}
+
+// configMixture returns the species of the mixture key of configSection,
+// i.e. mixture: {H2O: 0.02, CO2: 400e-6, CH4: 1.9e-6}, ordered by
+// decreasing mole fraction. It returns nil if no mixture is configured.
+func configMixture() ([]mixtureSpecies, error) {
+	key := sectionKey("mixture")
+	v := viper.Get(key)
+	if v == nil {
+		return nil, nil
+	}
+	fractions, err := cast.ToStringMapE(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: expected map of species to mole fraction. %s", key, err)
+	}
+	if len(fractions) == 0 {
+		return nil, nil
+	}
+	if configSection != hitranSection {
+		return nil, fmt.Errorf("%s: mixtures are only supported in the %s section", key, hitranSection)
+	}
+	if len(fractions) > mixtureSlots {
+		return nil, fmt.Errorf("%s: spectraplot mixes at most %d species. got %d", key, mixtureSlots, len(fractions))
+	}
+	var mix []mixtureSpecies
+	for name, x := range fractions {
+		f, err := cast.ToFloat64E(x)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", key, name, err)
+		}
+		// viper lowercases keys so gas IDs are matched ignoring case.
+		gas, database := parseSpecies(name)
+		gasID, ok := resolveGasID(gas)
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown species %s", key, name)
+		}
+		if err = checkSpecies(gasID, database); err != nil {
+			return nil, fmt.Errorf("%s: %s", key, err)
+		}
+		mix = append(mix, mixtureSpecies{gasID: gasID, database: database, Ppm: f * 1e6})
+	}
+	sort.Slice(mix, func(i, j int) bool {
+		if mix[i].Ppm != mix[j].Ppm {
+			return mix[i].Ppm > mix[j].Ppm
+		}
+		return mix[i].gasID < mix[j].gasID
+	})
+	return mix, nil
+}
+
+// resolveGasID returns the HITRAN gas ID matching gas ignoring case.
+func resolveGasID(gas string) (string, bool) {
+	for _, gasID := range hitranSpecies {
+		if strings.EqualFold(gas, gasID) {
+			return gasID, true
+		}
+	}
+	return gas, false
+}
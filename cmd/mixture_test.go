@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCrawlMixture(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	viper.Set("HITRAN.endNu", 1300.0)
+	viper.Set("HITRAN.mixture", map[string]interface{}{"co2": 400e-6, "h2o": 0.02})
+	d := &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// 3 intervals for the mixture, H2O and CO2 each.
+	if len(d.Calculated) != 9 {
+		t.Errorf("expected 9 calculations, got %d", len(d.Calculated))
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, gasID: "H2O_CO2", mixture: []mixtureSpecies{
+		{gasID: "H2O", Ppm: 2e4}, {gasID: "CO2", Ppm: 400},
+	}}
+	name := generateFilename(c, [2]float64{1000, 1300})
+	if name != "nu=1000-1300,H2O_CO2,x=0.020_4e-04,T=300K,P=1atm,L=100cm.csv" {
+		t.Errorf("unexpected mixture filename %s", name)
+	}
+	fo, err := os.Open(outDir + fpsep + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fo.Close()
+	records, err := csv.NewReader(fo).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := records[0]
+	if len(header) != 4 || header[1] != conditionString(c)+"/quantity=absorbance/unit=1" || header[2] != "H2O/x=0.02/T=300K/P=1atm/L=100cm" {
+		t.Fatalf("unexpected mixture header %q", header)
+	}
+	for _, record := range records[1:] {
+		var abs [3]float64
+		for i := range abs {
+			abs[i], _ = strconv.ParseFloat(record[i+1], 64)
+		}
+		if diff := abs[0] - abs[1] - abs[2]; diff > 1e-12 || diff < -1e-12 {
+			t.Fatalf("mixture absorbance %g is not the sum of species %g + %g", abs[0], abs[1], abs[2])
+		}
+	}
+	f, err := parseSpectraFilename(name)
+	if err != nil || len(f.conditions.mixture) != 2 || f.conditions.mixture[1].Ppm != 400 {
+		t.Errorf("unexpected parsed mixture %+v. %v", f.conditions, err)
+	}
+}
+
+func TestConfigMixture(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("HITRAN.mixture", map[string]interface{}{"ch4": 1.9e-6, "co2@hitemp": 400e-6, "h2o": 0.02})
+	mix, err := configMixture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := mixtureName(mix); name != "H2O_CO2@HITEMP_CH4" {
+		t.Errorf("unexpected mixture %s", name)
+	}
+	viper.Set("HITRAN.mixture", map[string]interface{}{"ch4": 1.9e-6, "co2": 400e-6, "h2o": 0.02, "n2o": 3e-7})
+	if _, err = configMixture(); err == nil {
+		t.Error("expected error for more species than slots")
+	}
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// mockAlerts are the alert divs of spectraplot's absorption page in order
+// of appearance as {id, class, message}.
+var mockAlerts = [][3]string{
+	{"alertDiv", "danger", "<strong>Sorry!</strong> Something went wrong with the calculation!"},
+	{"timeoutDiv", "warning", "<strong>Sorry!</strong> Your simulation took too long.  Reduce your simulation range or increase Δν."},
+	{"reduceDiv", "warning", "<strong>Sorry!</strong> We reduced your resolution ν<sub>step</sub> to reduce compute time."},
+	{"molefracDiv", "danger", "<strong>Every mole fraction must be less than 1!</strong> See \"How it works\" for an explanation of how mixtures are handled."},
+	{"molefracSurveyDiv", "danger", "<strong>Mole fractions should be less than 1!</strong> In the LineSurvey, mole fractions are used to scale linestrength."},
+	{"simrangeDiv", "warning", "<strong>You're simulating a big range.</strong> For surveys, we recommend using the LineSurvey tool."},
+	{"notinfraredDiv", "warning", "<strong>Your wavelength is quite short!</strong> Check the HITRAN documentation to see if visible/UV lines are included for this species."},
+	{"reduceLinesDiv", "warning", "<strong>Not all of your lines were plotted, sorry!</strong> Either reduce your simulation window or increase the Linestrength cutoff."},
+	{"toobigDiv", "danger", "<strong>Your simulation range is too big, Sorry!</strong> We can only simulate 3000 cm<sup>-1</sup> at a time."},
+	{"toobigAbsEmisDiv", "danger", "<strong>Your simulation range is too big, Sorry!</strong> We can only simulate 100 cm<sup>-1</sup> at a time."},
+	{"surveyZeroCutoff", "danger", "<strong>Sorry!</strong>  Your minimum linestrength must be greater than 1e-10!"},
+	{"n2hitran", "warning", "<strong>It looks like you're simulating N<sub>2</sub> with a relatively short pathlength.</strong>  N<sub>2</sub> is only weakly infrared active."},
+	{"einsteinA", "warning", "<strong>Some lines for <span id=\"alertSpec\"></span> in your simulation have estimated line strengths.</strong>"},
+	{"badspecies", "danger", "<strong>HITEMP CO<sub>2</sub> and H<sub>2</sub>O have a lot of lines!</strong> Please reduce your simulation window to less than 1000 cm<sup>-1</sup>."},
+}
+
+var (
+	mockHitranSpecies = [][]string{
+		{"CH3Cl", "CH3CN", "CH3OH", "CH4", "CO", "CO2", "COF2", "C2H2", "C2H4", "C2H6", "ClO"},
+		{"HCOOH", "HCN", "HBr", "HCl", "HF", "HI", "HNO3", "HOBr", "HOCl", "H2O", "H2O2", "H2CO", "H2S"},
+		{"NH3", "NO", "NO2", "NO+", "N2", "N2O", "O", "O2", "O3", "OCS", "OH", "PH3", "SO2"},
+	}
+	mockHitempSpecies = [][]string{{"CO", "CO2"}, {"H2O"}, {"NO", "OH"}}
+	// mockNistAtoms are the rows of the mock's periodic table species picker.
+	mockNistAtoms = [][]string{{"H", "He"}, {"Li", "Be", "Na", "Mg"}, {"K", "Ca", "Rb", "Sr", "Cs", "Ba"}}
+)
+
+// mockPage is the HTML served by mockServer. Element ids, input names and
+// table layout follow testdata/html/spectra.html so the same selectors work.
+var mockPage = buildMockPage()
+
+func buildMockPage() string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>
+<html><head><meta charset="utf-8">
+<title>SpectraPlot.com - Absorption spectroscopy simulator (mock)</title>
+<style>
+.dropdown-menu { display: none; }
+.open > .dropdown-menu { display: block; }
+.row { width: 400px; }
+.list-unstyled { display: inline-block; vertical-align: top; list-style: none; }
+.hitran_species, .nist_species { cursor: pointer; }
+.tab-pane { display: none; }
+.tab-pane.active { display: block; }
+</style>
+</head><body>
+`)
+	for _, a := range mockAlerts {
+		fmt.Fprintf(&b, `<div class="alert alert-%[2]s alert-dismissible" role="alert" hidden="true" id="%[1]s" style="display: none;">
+    <button type="button" class="close" onclick="document.getElementById('%[1]s').style.display = 'none';"><span aria-hidden="true">×</span></button>
+    %[3]s
+</div>
+`, a[0], a[1], a[2])
+	}
+	b.WriteString(`<section><div role="tabpanel">
+<ul class="nav nav-tabs" role="tablist">
+<li role="presentation" class="active"><a href="#hitran" aria-controls="hitran" role="tab" data-toggle="tab"><b>HITRAN/HITEMP</b></a></li>
+<li role="presentation"><a href="#nist" aria-controls="nist" role="tab" data-toggle="tab"><b>NIST ASD</b></a></li>
+</ul>
+<div class="tab-content">
+<div role="tabpanel" class="tab-pane active" id="hitran">
+<div class="row col-xs-12">
+<div class="col-xs-11 text-center">
+<table align="center" class="FrontPanel"><tbody>
+<tr class="spectable">
+<td></td>
+<td>T (K) = <input type="text" size="5" name="T_hitran" value="300" tabindex="1"></td>
+<td>λ<sub>start</sub> (μm) = <input type="text" size="5" name="lstart_hitran" value="4.5558" tabindex="4"></td>
+<td>or</td>
+<td>ν<sub>start</sub> (cm<sup>-1</sup>) = <input type="text" size="5" name="vstart_hitran" value="2195" tabindex="6"></td>
+`)
+	b.WriteString(mockSpeciesMenu(1, "CO"))
+	b.WriteString(`<td>χ<sub><span id="xspec1_hitran" class="specspan">CO</span></sub> = <input type="text" size="5" name="xspecies1_hitran" value=".0001" tabindex="9"></td>
+<td><button class="btn btn-danger" data-loading-text="Calculating..." id="calculate_hitran">Calculate</button></td>
+</tr>
+<tr class="spectable">
+<td></td>
+<td>P (atm) = <input type="text" size="5" name="P_hitran" value="1" tabindex="2"></td>
+<td>λ<sub>end</sub> (μm) = <input type="text" size="5" name="lend_hitran" value="4.5045" tabindex="5"></td>
+<td>or</td>
+<td>ν<sub>end</sub> (cm<sup>-1</sup>) = <input type="text" size="5" name="vend_hitran" value="2220" tabindex="7"></td>
+`)
+	b.WriteString(mockSpeciesMenu(2, "Species"))
+	b.WriteString(`<td>χ<sub><span id="xspec2_hitran" class="specspan">Species</span></sub> = <input type="text" size="5" name="xspecies2_hitran" value="0" tabindex="10"></td>
+<td><button class="btn btn-primary" id="clear">Clear plot</button></td>
+</tr>
+<tr class="spectable">
+<td></td>
+<td>L (cm) = <input type="text" size="5" name="L_hitran" value="100" tabindex="3"></td>
+<td></td>
+<td></td>
+<td>ν<sub>step</sub> (cm<sup>-1</sup>) = <input type="text" size="5" name="deltav_hitran" value="0.01" tabindex="8"></td>
+`)
+	b.WriteString(mockSpeciesMenu(3, "Species"))
+	b.WriteString(`<td>χ<sub><span id="xspec3_hitran" class="specspan">Species</span></sub> = <input type="text" size="5" name="xspecies3_hitran" value="0" tabindex="12"></td>
+<td></td>
+</tr>
+</tbody></table>
+</div>
+</div>
+</div>
+`)
+	b.WriteString(mockNistTab())
+	b.WriteString(`</div></div></section>
+<section>
+<button class="btn btn-primary" id="data">Save to CSV</button>
+<div id="downloaddiv" style="display: none;"><form id="exportform" action="/_saveCSV" method="post"><textarea name="data"></textarea><textarea name="conditions"></textarea></form></div>
+<div id="chart"><p id="plotcount">0 plots</p></div>
+</section>
+<script>
+var lines = [];
+function field(name) { return document.getElementsByName(name)[0].value; }
+function show(id) { document.getElementById(id).style.display = 'block'; }
+function redraw() { document.getElementById('plotcount').textContent = lines.length + ' plots'; }
+document.querySelectorAll('.dropdown-toggle').forEach(function (a) {
+    a.addEventListener('click', function (ev) { ev.preventDefault(); a.parentNode.classList.toggle('open'); });
+});
+document.querySelectorAll('.hitran_species').forEach(function (a) {
+    a.addEventListener('click', function () {
+        var li = a.closest('li.dropdown');
+        var n = li.querySelector('.dropdown-toggle').id.charAt(4);
+        document.getElementById('specspan' + n + '_hitran').textContent = a.textContent;
+        document.getElementById('xspec' + n + '_hitran').textContent = a.textContent;
+        li.classList.remove('open');
+    });
+});
+document.querySelectorAll('a[data-toggle=tab]').forEach(function (a) {
+    a.addEventListener('click', function (ev) {
+        ev.preventDefault();
+        document.querySelectorAll('.tab-pane, [role=presentation]').forEach(function (e) { e.classList.remove('active'); });
+        a.parentNode.classList.add('active');
+        document.querySelector(a.getAttribute('href')).classList.add('active');
+    });
+});
+document.querySelectorAll('.ionstate button').forEach(function (btn) {
+    btn.addEventListener('click', function (ev) {
+        ev.preventDefault();
+        btn.parentNode.querySelectorAll('button').forEach(function (e) { e.classList.remove('active'); });
+        btn.classList.add('active');
+    });
+});
+document.querySelectorAll('.nist_species').forEach(function (a) {
+    a.addEventListener('click', function () {
+        var li = a.closest('li.dropdown');
+        document.getElementById('specspan1_nist').textContent = a.textContent;
+        document.getElementById('xspec1_nist').textContent = a.textContent;
+        li.classList.remove('open');
+    });
+});
+document.getElementById('calculate_hitran').addEventListener('click', function () {
+    var specs = [1, 2, 3].map(function (n) { return document.getElementById('specspan' + n + '_hitran').textContent; });
+    calculate(this, '_hitran', '/_calcHITRAN', ['T', 'P', 'L', 'vstart', 'vend', 'deltav', 'xspecies1', 'xspecies2', 'xspecies3'], specs);
+});
+document.getElementById('calculate_nist').addEventListener('click', function () {
+    var ion = {ground: '', plus1: '+', plus2: '2+'}[document.querySelector('#nist .ionstate button.active').id];
+    var spec = document.getElementById('specspan1_nist').textContent + ion;
+    calculate(this, '_nist', '/_calcNIST', ['Telec', 'T', 'P', 'L', 'vstart', 'vend', 'deltav', 'xspecies1'], [spec]);
+});
+function calculate(b, tab, path, names, specs) {
+    b.textContent = 'Calculating...';
+    var body = names.map(function (n) {
+        return n + tab + '=' + encodeURIComponent(field(n + tab));
+    });
+    specs.forEach(function (spec, i) {
+        body.push('spec' + (i + 1) + tab + '=' + encodeURIComponent(spec));
+    });
+    var xhr = new XMLHttpRequest();
+    xhr.open('POST', path);
+    xhr.setRequestHeader('Content-Type', 'application/x-www-form-urlencoded');
+    xhr.onload = function () {
+        b.textContent = 'Calculate';
+        if (xhr.status !== 200) { show('alertDiv'); return; }
+        var r = JSON.parse(xhr.responseText);
+        if (r.alert) { show(r.alert); }
+        if (!r.line) { return; }
+        lines.push(r);
+        redraw();
+    };
+    xhr.onerror = function () { b.textContent = 'Calculate'; show('alertDiv'); };
+    xhr.send(body.join('&'));
+}
+document.getElementById('clear').addEventListener('click', function () { lines = []; redraw(); });
+document.getElementById('data').addEventListener('click', function () {
+    var form = document.getElementById('exportform'), data = {};
+    lines.forEach(function (l, i) { data['line' + i] = l.line; });
+    form.elements['data'].value = JSON.stringify(data);
+    form.elements['conditions'].value = lines.map(function (l) { return l.conditions; }).join('\n');
+    form.submit();
+});
+</script>
+</body></html>
+`)
+	return b.String()
+}
+
+// mockSpeciesMenu returns the table cell holding species picker n.
+func mockSpeciesMenu(n int, selected string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<td><div class="btn-group"><ul id="multicol-menu" class="nav"><li class="dropdown">
+<a href="#" class="dropdown-toggle" data-toggle="dropdown" id="spec%[1]d_hitran"><span class="specspan" id="specspan%[1]d_hitran">%[2]s</span><b class="caret"></b></a>
+<ul class="dropdown-menu nav"><li>
+<b><u>HITRAN 2012</u></b>
+<div class="row">
+`, n, selected)
+	for _, column := range mockHitranSpecies {
+		b.WriteString(`<ul class="list-unstyled col-xs-4">`)
+		for _, gas := range column {
+			fmt.Fprintf(&b, `<li><a class="hitran_species">%s</a></li>`, subscriptHTML(gas))
+		}
+		b.WriteString("</ul>\n")
+	}
+	b.WriteString(`</div>
+<br><b><u>HITEMP 2010</u></b><br>
+<div class="row">
+`)
+	for _, column := range mockHitempSpecies {
+		b.WriteString(`<ul class="list-unstyled col-xs-4">`)
+		for _, gas := range column {
+			fmt.Fprintf(&b, `<li><a class="hitran_species">%s<sub><span class="db" style="display:none"> HITEMP</span><sub></sub></sub></a></li>`, subscriptHTML(gas))
+		}
+		b.WriteString("</ul>\n")
+	}
+	b.WriteString("</div>\n</li></ul>\n</li></ul></div></td>\n")
+	return b.String()
+}
+
+// mockNistTab returns the NIST ASD tab pane with a single species picker.
+func mockNistTab() string {
+	var b strings.Builder
+	b.WriteString(`<div role="tabpanel" class="tab-pane" id="nist">
+<div class="row col-xs-12">
+<div class="col-xs-11 text-center">
+<table align="center" class="FrontPanel"><tbody>
+<tr class="spectable">
+<td>T<sub>elec</sub> (K) = <input type="text" size="5" name="Telec_nist" value="1000" tabindex="1"></td>
+<td>T (K) = <input type="text" size="5" name="T_nist" value="300" tabindex="1"></td>
+<td>λ<sub>start</sub> (μm) = <input type="text" size="5" name="lstart_nist" value="0.588" tabindex="4"></td>
+<td>or</td>
+<td>ν<sub>start</sub> (cm<sup>-1</sup>) = <input type="text" size="5" name="vstart_nist" value="17006" tabindex="6"></td>
+<td><div class="btn-group"><ul id="multicol-menu" class="nav"><li class="dropdown">
+<a class="dropdown-toggle" data-toggle="dropdown" id="spec1_nist"><span class="specspan" id="specspan1_nist">Na</span><b class="caret"></b></a>
+<ul class="dropdown-menu nav"><li>
+<b><u>NIST Atomic Spectra Database </u></b>
+<div class="row">
+Ionization State:
+<span class="nist_ion"><table class="nistTable ionstate"><tbody><tr><td><button class="btn btn-default active" id="ground">X</button>
+<button class="btn btn-default" id="plus1">X<sup>+</sup></button>
+<button class="btn btn-default" id="plus2">X<sup>2+</sup></button></td></tr></tbody></table></span>
+<table class="nistTable"><tbody>
+`)
+	for _, row := range mockNistAtoms {
+		b.WriteString("<tr>")
+		for _, atom := range row {
+			fmt.Fprintf(&b, `<td><a class="nist_species">%s</a></td>`, atom)
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString(`</tbody></table>
+</div>
+</li></ul>
+</li></ul></div></td>
+<td>χ<sub><span id="xspec1_nist" class="specspan">Na</span></sub> = <input type="text" size="5" name="xspecies1_nist" value=".1e-6" tabindex="9"></td>
+<td><button class="btn btn-danger" data-loading-text="Calculating..." id="calculate_nist">Calculate</button></td>
+</tr>
+<tr class="spectable">
+<td></td>
+<td>P (atm) = <input type="text" size="5" name="P_nist" value="1" tabindex="2"></td>
+<td>λ<sub>end</sub> (μm) = <input type="text" size="5" name="lend_nist" value=".310" tabindex="5"></td>
+<td>or</td>
+<td>ν<sub>end</sub> (cm<sup>-1</sup>) = <input type="text" size="5" name="vend_nist" value="16949" tabindex="7"></td>
+</tr>
+<tr class="spectable">
+<td></td>
+<td>L (cm) = <input type="text" size="5" name="L_nist" value="1" tabindex="3"></td>
+<td></td>
+<td></td>
+<td>ν<sub>step</sub> (cm<sup>-1</sup>) = <input type="text" size="5" name="deltav_nist" value="0.01" tabindex="8"></td>
+</tr>
+</tbody></table>
+</div>
+</div>
+</div>
+`)
+	return b.String()
+}
+
+// subscriptHTML subscripts the digits of a chemical formula, i.e. CH4 -> CH<sub>4</sub>.
+func subscriptHTML(formula string) string {
+	var b strings.Builder
+	for _, r := range formula {
+		if unicode.IsDigit(r) {
+			fmt.Fprintf(&b, "<sub>%c</sub>", r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
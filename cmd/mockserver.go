@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// mockServer is a stand-in for spectraplot.com's absorption page. It serves a
+// page with the same form inputs, buttons and alert divs spectracrawl drives
+// and answers calculations with deterministic synthetic spectra, so the crawl
+// loop can be exercised against a local browser without internet access.
+type mockServer struct {
+	// CalcDelay is how long a calculation takes to answer. Set it above
+	// spectraplot.calcTimeout_s to provoke ErrTimeout.
+	CalcDelay time.Duration
+	// Alert is the id of an alert div (i.e. "alertDiv", "toobigDiv") shown
+	// when calculating, in place of the plot if the alert fails the
+	// calculation and along with it otherwise.
+	Alert string
+	// CorruptZip makes the CSV download return a file that is not a zip archive.
+	CorruptZip bool
+}
+
+// plotLine is a single calculated spectrum as held by the spectraplot page.
+type plotLine struct {
+	Conditions string
+	Nu, Abs    []float64
+}
+
+const (
+	mockCalcPath     = "/_calcHITRAN"
+	mockNistCalcPath = "/_calcNIST"
+	mockSavePath     = "/_saveCSV"
+)
+
+func (m *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/", "/absorption":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, mockPage)
+	case mockCalcPath:
+		m.calculate(w, r, "_hitran")
+	case mockNistCalcPath:
+		m.calculate(w, r, "_nist")
+	case mockSavePath:
+		m.saveCSV(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// calculate answers a calculation of the form inputs of the tab whose
+// input names end in tab, either "_hitran" or "_nist".
+func (m *mockServer) calculate(w http.ResponseWriter, r *http.Request, tab string) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	time.Sleep(m.CalcDelay)
+	w.Header().Set("Content-Type", "application/json")
+	if m.Alert != "" && newAlertError(m.Alert, "", false).fails() {
+		_ = json.NewEncoder(w).Encode(map[string]string{"alert": m.Alert})
+		return
+	}
+	var c spectraConditions
+	var err error
+	fields := map[string]*float64{
+		"T": &c.T, "P": &c.P, "L": &c.L, "xspecies1": &c.Ppm,
+		"vstart": &c.NuStart, "vend": &c.NuEnd, "deltav": &c.NuStep,
+	}
+	if tab == "_nist" {
+		fields["Telec"] = &c.Telec
+	}
+	for name, dst := range fields {
+		key := name + tab
+		*dst, err = strconv.ParseFloat(strings.TrimSpace(r.FormValue(key)), 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("bad %s: %s", key, err), http.StatusBadRequest)
+			return
+		}
+	}
+	c.Ppm *= 1e6
+	c.gasID, c.database = parseSpecies(r.FormValue("spec1" + tab))
+	if tab == "_nist" {
+		c.database = dbNIST
+	}
+	// slots 2 and 3 make a mixture when holding a species with x > 0.
+	mix := []mixtureSpecies{{gasID: c.gasID, database: c.database, Ppm: c.Ppm}}
+	for slot := 2; slot <= mixtureSlots; slot++ {
+		x, _ := strconv.ParseFloat(strings.TrimSpace(r.FormValue(fmt.Sprintf("xspecies%d%s", slot, tab))), 64)
+		species := r.FormValue(fmt.Sprintf("spec%d%s", slot, tab))
+		if x > 0 && species != "" && species != "Species" {
+			s := mixtureSpecies{Ppm: x * 1e6}
+			s.gasID, s.database = parseSpecies(species)
+			mix = append(mix, s)
+		}
+	}
+	if len(mix) > 1 {
+		c.mixture, c.gasID, c.database, c.Ppm = mix, mixtureName(mix), "", 0
+	}
+	line := syntheticSpectrum(c)
+	type point struct {
+		Abs float64 `json:"abs"`
+		Nu  float64 `json:"nu"`
+	}
+	points := make([]point, len(line.Nu))
+	for i := range line.Nu {
+		points[i] = point{Abs: line.Abs[i], Nu: line.Nu[i]}
+	}
+	calc := map[string]interface{}{"conditions": line.Conditions, "line": points}
+	if m.Alert != "" {
+		calc["alert"] = m.Alert
+	}
+	_ = json.NewEncoder(w).Encode(calc)
+}
+
+// saveCSV mimics spectraplot's export form: data holds the plotted lines
+// as JSON and conditions one condition string per line.
+func (m *mockServer) saveCSV(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lines, err := parseExportForm(r.FormValue("data"), r.FormValue("conditions"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+defaultZipName)
+	if m.CorruptZip {
+		_, _ = io.WriteString(w, "PK\x03\x04 this is not a zip archive")
+		return
+	}
+	if err := writeSpectraZip(w, lines); err != nil {
+		logf("[err] mock server writing zip: %s", err)
+	}
+}
+
+// syntheticSpectrum returns a deterministic absorbance spectrum for the conditions
+// given. Lines are Lorentzian and placed depending on gasID and database so
+// that different species yield different spectra. Mixtures absorb as the sum
+// of their species.
+func syntheticSpectrum(c spectraConditions) plotLine {
+	if len(c.mixture) > 0 {
+		line := plotLine{Conditions: conditionString(c)}
+		for i, component := range c.components() {
+			l := syntheticSpectrum(component)
+			if i == 0 {
+				line.Nu, line.Abs = l.Nu, l.Abs
+				continue
+			}
+			for j := range line.Abs {
+				line.Abs[j] += l.Abs[j]
+			}
+		}
+		return line
+	}
+	const spacing = 7.3
+	var phase float64
+	for _, r := range c.species() {
+		phase += float64(r)
+	}
+	phase = math.Mod(phase, spacing)
+	gamma := 0.07 * c.P * math.Sqrt(296/c.T)
+	x := c.Ppm * 1e-6
+	line := plotLine{Conditions: conditionString(c)}
+	n := int(math.Round((c.NuEnd-c.NuStart)/c.NuStep)) + 1
+	for i := 0; i < n; i++ {
+		nu := c.NuStart + float64(i)*c.NuStep
+		k := math.Round((nu - phase) / spacing)
+		var abs float64
+		for j := k - 2; j <= k+2; j++ {
+			d := nu - (j*spacing + phase)
+			abs += 1e-3 * gamma / math.Pi / (d*d + gamma*gamma)
+		}
+		line.Nu = append(line.Nu, nu)
+		line.Abs = append(line.Abs, x*c.P*c.L*abs)
+	}
+	return line
+}
+
+// writeSpectraZip writes lines to w as a spectraplot simulations zip archive,
+// one CSV file per line.
+func writeSpectraZip(w io.Writer, lines []plotLine) error {
+	zw := zip.NewWriter(w)
+	for i, line := range lines {
+		name := strings.ReplaceAll(line.Conditions, "/", ",")
+		f, err := zw.Create(fmt.Sprintf("%s,simNum%d.csv", name, i))
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(f, "nu,%s\n", line.Conditions); err != nil {
+			return err
+		}
+		for j := range line.Nu {
+			_, err = fmt.Fprintf(f, "%s,%s\n", strconv.FormatFloat(line.Nu[j], 'f', -1, 64),
+				strconv.FormatFloat(line.Abs[j], 'g', -1, 64))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+var mockFlags struct {
+	addr string
+	mock mockServer
+}
+
+var mockCmd = &cobra.Command{
+	Use:   "mock",
+	Short: "Serves a local fake of spectraplot's absorption page",
+	Long: `Serves a local fake of spectraplot's absorption page
+
+The page has the same form, buttons and alerts as spectraplot.com
+and returns deterministic spectra. Point spectraplot.url at it to
+crawl without internet access. Failures can be injected with flags.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ln, err := net.Listen("tcp", mockFlags.addr)
+		if err != nil {
+			return err
+		}
+		logf("[inf] mock spectraplot serving at http://%s/absorption", ln.Addr())
+		return http.Serve(ln, &mockFlags.mock)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mockCmd)
+	mockCmd.Flags().StringVar(&mockFlags.addr, "addr", "127.0.0.1:8080", "address to listen on")
+	mockCmd.Flags().DurationVar(&mockFlags.mock.CalcDelay, "delay", 200*time.Millisecond, "calculation duration")
+	mockCmd.Flags().StringVar(&mockFlags.mock.Alert, "alert", "", "id of alert div to show on calculate (i.e. alertDiv)")
+	mockCmd.Flags().BoolVar(&mockFlags.mock.CorruptZip, "corrupt", false, "serve a corrupt zip on download")
+}
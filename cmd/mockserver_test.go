@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMockServerPage(t *testing.T) {
+	srv := httptest.NewServer(&mockServer{})
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/absorption")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	page := string(b)
+	for _, want := range []string{`id="hitran"`, `id="calculate_hitran"`, `id="data"`, `id="clear"`,
+		`id="multicol-menu"`, `name="T_hitran"`, `name="vstart_hitran"`, `id="alertDiv"`, `CH<sub>4</sub>`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("mock page missing %s", want)
+		}
+	}
+}
+
+func TestMockServerCrawl(t *testing.T) {
+	srv := httptest.NewServer(&mockServer{})
+	defer srv.Close()
+	want := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, NuStep: 0.01, gasID: "CH4"}
+	data := map[string]json.RawMessage{}
+	var conditions []string
+	for i, nu := range []float64{6200, 6300} {
+		form := url.Values{
+			"T_hitran": {"300"}, "P_hitran": {"1"}, "L_hitran": {"100"}, "xspecies1_hitran": {"1e-6"},
+			"vstart_hitran": {jsFloat(nu)}, "vend_hitran": {jsFloat(nu + 100)}, "deltav_hitran": {"0.01"},
+			"spec1_hitran": {want.gasID},
+		}
+		resp, err := http.PostForm(srv.URL+mockCalcPath, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var calc struct {
+			Conditions string
+			Line       json.RawMessage
+		}
+		err = json.NewDecoder(resp.Body).Decode(&calc)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data["line"+string(rune('0'+i))] = calc.Line
+		conditions = append(conditions, calc.Conditions)
+	}
+	b, _ := json.Marshal(data)
+	resp, err := http.PostForm(srv.URL+mockSavePath, url.Values{"data": {string(b)}, "conditions": {strings.Join(conditions, "\n")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	dir := t.TempDir()
+	zipName := filepath.Join(dir, defaultZipName)
+	fo, err := os.Create(zipName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(fo, resp.Body)
+	fo.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = processSpectra(zipName, dir, want, [][2]float64{{6200, 6300}, {6300, 6400}}); err != nil {
+		t.Fatal(err)
+	}
+	expected := generateFilename(want, [2]float64{6200, 6400})
+	if _, err = os.Stat(filepath.Join(dir, expected)); err != nil {
+		t.Errorf("expected merged output %s. %s", expected, err)
+	}
+}
+
+func TestMockServerAlert(t *testing.T) {
+	srv := httptest.NewServer(&mockServer{Alert: "toobigDiv"})
+	defer srv.Close()
+	resp, err := http.PostForm(srv.URL+mockCalcPath, url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var calc map[string]string
+	if err = json.NewDecoder(resp.Body).Decode(&calc); err != nil {
+		t.Fatal(err)
+	}
+	if calc["alert"] != "toobigDiv" {
+		t.Errorf("expected toobigDiv alert, got %v", calc)
+	}
+}
+
+func TestMockServerNist(t *testing.T) {
+	srv := httptest.NewServer(&mockServer{})
+	defer srv.Close()
+	form := url.Values{
+		"Telec_nist": {"1000"}, "T_nist": {"300"}, "P_nist": {"1"}, "L_nist": {"1"}, "xspecies1_nist": {"1e-6"},
+		"vstart_nist": {"16900"}, "vend_nist": {"17000"}, "deltav_nist": {"0.01"}, "spec1_nist": {"K+"},
+	}
+	resp, err := http.PostForm(srv.URL+mockNistCalcPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var calc struct{ Conditions string }
+	if err = json.NewDecoder(resp.Body).Decode(&calc); err != nil {
+		t.Fatal(err)
+	}
+	if calc.Conditions != "K+ NIST/Te=1000K/x=1e-6/T=300K/P=1atm/L=1cm" {
+		t.Fatalf("unexpected NIST conditions %q", calc.Conditions)
+	}
+	c, err := parseSpectraConditions(strings.Split(calc.Conditions, "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "nu=16900-17000,K+@NIST,Te=1e+03K,x=1e-06,T=300K,P=1atm,L=1cm.csv"
+	if name := generateFilename(c, [2]float64{16900, 17000}); name != want {
+		t.Errorf("expected %s, got %s", want, name)
+	}
+}
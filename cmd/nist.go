@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var nistCmd = &cobra.Command{
+	Use:   "nist",
+	Short: "Scrapes NIST ASD atomic absorption data from spectraplot's NIST tab",
+	Long: `Scrapes NIST ASD atomic absorption data from spectraplot's NIST tab
+
+Species and conditions are read from the NIST config section, which takes
+the same keys as the HITRAN section plus Telec, the electronic temperature.
+gasID holds atoms with their ionization state, i.e. Na, K+ or Ca2+.
+Spectra are merged and written to output.dir like HITRAN spectra.
+`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		configSection = nistSection
+		return configArgs(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCommand(cmd, "[inf] starting NIST crawl", func(ctx context.Context) error { return runner(ctx, args) })
+	},
+}
+
+// setNist fills the NIST tab form with conditions.
+func setNist(s browserSession, conditions spectraConditions) error {
+	if err := leftClickSelector(s, selector("nistTab")); err != nil {
+		return ErrPageScan
+	}
+	var format string
+	if format = viper.GetString(sectionKey("format")); format == "" {
+		format = "%.3f"
+	}
+	return fillForm(s, []formField{
+		{selector("nistTelec"), format, conditions.Telec},
+		{selector("nistT"), format, conditions.T},
+		{selector("nistP"), format, conditions.P},
+		{selector("nistL"), format, conditions.L},
+		{selector("nistNuStart"), format, conditions.NuStart},
+		{selector("nistNuEnd"), format, conditions.NuEnd},
+		{selector("nistNuStep"), "%0.3f", conditions.NuStep},
+		{selector("nistX", 1), strings.Replace(format, "f", "e", 1), conditions.Ppm * 1e-6},
+	})
+}
+
+// selectNistSpecies sets the ionization state and clicks the atom of
+// gasID, i.e. K+, in the NIST species menu of slot, then checks the slot
+// label shows the atom.
+func selectNistSpecies(s browserSession, slot int, gasID string) error {
+	atom, ionButton, ok := nistAtom(gasID)
+	if !ok {
+		return fmt.Errorf("%s is not an atom with ionization state", gasID)
+	}
+	if err := leftClickSelector(s, selector("nistSpeciesMenu", slot)); err != nil {
+		return ErrPageScan
+	}
+	if err := leftClickSelector(s, selector("nistIon", slot, ionButton)); err != nil {
+		return ErrPageScan
+	}
+	atoms, err := s.FindElements("css selector", selector("nistSpecies", slot))
+	if err != nil {
+		return err
+	}
+	for _, e := range atoms {
+		if name, _ := e.Text(); strings.TrimSpace(name) != atom {
+			continue
+		}
+		if err = e.Click(); err != nil {
+			return err
+		}
+		return checkSpeciesLabel(s, selector("nistSpeciesLabel", slot), atom, "")
+	}
+	return fmt.Errorf("atom %s not in NIST species menu of slot %d", atom, slot)
+}
+
+func init() {
+	rootCmd.AddCommand(nistCmd)
+}
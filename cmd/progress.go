@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// progress counts the intervals of a crawl and times their calculations
+// and downloads. On terminals it keeps a status line with the ETA under
+// the log.
+type progress struct {
+	mu    sync.Mutex
+	out   io.Writer
+	live  bool
+	start time.Time
+	// job is the condition string of the job being crawled.
+	job                            string
+	pending, done, failed, skipped int
+	calcTimes, downloadTimes       []time.Duration
+	calcTotal, downloadTotal       time.Duration
+}
+
+// crawlProgress is the progress of the running crawl, nil outside crawls.
+var crawlProgress atomic.Pointer[progress]
+
+// startProgress starts tracking a crawl. The status line is drawn only if
+// stdout is a terminal and log.silent is not set.
+func startProgress() *progress {
+	p := &progress{out: os.Stdout, start: time.Now()}
+	p.live = !viper.GetBool("log.silent") && isTerminal(os.Stdout)
+	crawlProgress.Store(p)
+	return p
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// finish stops tracking the crawl, clears the status line and logs a
+// summary with timing percentiles.
+func (p *progress) finish() {
+	crawlProgress.CompareAndSwap(p, nil)
+	p.mu.Lock()
+	p.clear()
+	p.live = false
+	fields := []interface{}{
+		"done", p.done, "failed", p.failed, "skipped", p.skipped, "left", p.pending,
+		"elapsed", time.Since(p.start).Round(time.Second),
+	}
+	for _, q := range []float64{50, 90, 99} {
+		fields = append(fields, fmt.Sprintf("calcP%.f", q), percentile(p.calcTimes, q))
+	}
+	for _, q := range []float64{50, 90, 99} {
+		fields = append(fields, fmt.Sprintf("downloadP%.f", q), percentile(p.downloadTimes, q))
+	}
+	p.mu.Unlock()
+	logEvent(slog.LevelInfo, "crawl summary", fields...)
+}
+
+// percentile returns the q-th percentile of durations by nearest rank.
+func percentile(durations []time.Duration, q float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(q/100*float64(len(sorted)) + 0.5)
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// update applies fn to p under its lock and redraws the status line.
+// It is a no-op on a nil progress so crawls work without tracking.
+func (p *progress) update(fn func(p *progress)) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(p)
+	p.draw()
+}
+
+// addJob starts the job of conditions c with n intervals to crawl.
+func (p *progress) addJob(c spectraConditions, n int) {
+	p.update(func(p *progress) {
+		p.job = conditionString(c)
+		p.pending += n
+	})
+}
+
+// skip counts n intervals found already written to file.
+func (p *progress) skip(n int) {
+	p.update(func(p *progress) { p.pending -= n; p.skipped += n })
+}
+
+// finishBatch counts a batch of n intervals of which failed could not be crawled.
+func (p *progress) finishBatch(n, failed int) {
+	p.update(func(p *progress) { p.pending -= n; p.done += n - failed; p.failed += failed })
+}
+
+// retry moves failed intervals back to pending as n intervals, more than
+// failed if they were split.
+func (p *progress) retry(failed, n int) {
+	p.update(func(p *progress) { p.failed -= failed; p.pending += n })
+}
+
+// calculated records the calculation time of an interval.
+func (p *progress) calculated(d time.Duration) {
+	p.update(func(p *progress) { p.calcTimes = append(p.calcTimes, d); p.calcTotal += d })
+}
+
+// downloaded records the download time of a batch.
+func (p *progress) downloaded(d time.Duration) {
+	p.update(func(p *progress) { p.downloadTimes = append(p.downloadTimes, d); p.downloadTotal += d })
+}
+
+// eta estimates the time left from the average wall time per crawled interval.
+func (p *progress) eta() time.Duration {
+	crawled := p.done + p.failed
+	if crawled == 0 || p.pending <= 0 {
+		return 0
+	}
+	return time.Since(p.start) / time.Duration(crawled) * time.Duration(p.pending)
+}
+
+// status returns the status line of p.
+func (p *progress) status() string {
+	var calc, download time.Duration
+	if len(p.calcTimes) > 0 {
+		calc = p.calcTotal / time.Duration(len(p.calcTimes))
+	}
+	if len(p.downloadTimes) > 0 {
+		download = p.downloadTotal / time.Duration(len(p.downloadTimes))
+	}
+	eta := "--"
+	if d := p.eta(); d > 0 {
+		eta = d.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%s | %d done, %d failed, %d left | calc %s/interval, download %s | ETA %s",
+		p.job, p.done, p.failed, p.pending, calc.Round(10*time.Millisecond), download.Round(10*time.Millisecond), eta)
+}
+
+// draw writes the status line over the current line. Callers hold p.mu.
+func (p *progress) draw() {
+	if p.live {
+		fmt.Fprint(p.out, "\r\x1b[K"+p.status())
+	}
+}
+
+// clear erases the status line. Callers hold p.mu.
+func (p *progress) clear() {
+	if p.live {
+		fmt.Fprint(p.out, "\r\x1b[K")
+	}
+}
+
+// stdoutWriter writes log lines to stdout above the status line of the
+// running crawl.
+type stdoutWriter struct{}
+
+func (stdoutWriter) Write(b []byte) (int, error) {
+	p := crawlProgress.Load()
+	if p == nil {
+		return os.Stdout.Write(b)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	n, err := os.Stdout.Write(b)
+	p.draw()
+	return n, err
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 10; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+	for q, want := range map[float64]time.Duration{50: 5 * time.Second, 90: 9 * time.Second, 99: 10 * time.Second} {
+		if got := percentile(durations, q); got != want {
+			t.Errorf("percentile %v: expected %s, got %s", q, want, got)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("expected 0 for no durations, got %s", got)
+	}
+}
+
+func TestProgressStatus(t *testing.T) {
+	var buf bytes.Buffer
+	p := &progress{out: &buf, live: true, start: time.Now().Add(-time.Minute)}
+	p.addJob(spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}, 6)
+	p.calculated(2 * time.Second)
+	p.calculated(4 * time.Second)
+	p.downloaded(time.Second)
+	p.finishBatch(3, 1)
+	p.retry(1, 2)
+	status := p.status()
+	for _, want := range []string{"CH4", "2 done, 0 failed, 5 left", "calc 3s/interval", "download 1s", "ETA 2m30s"} {
+		if !strings.Contains(status, want) {
+			t.Errorf("expected %q in status %q", want, status)
+		}
+	}
+	if !strings.HasPrefix(buf.String(), "\r\x1b[K") {
+		t.Errorf("expected status line redrawn in place, got %q", buf.String())
+	}
+}
+
+func TestCrawlSummary(t *testing.T) {
+	setCrawlConfig(t)
+	viper.Set("log.format", "json")
+	var buf bytes.Buffer
+	h, err := newLogHandler(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger = slog.New(h)
+	t.Cleanup(func() { logger = nil })
+	d := &fakeDriver{Dir: t.TempDir(), CalcErrs: []error{nil, ErrTimeout}}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if crawlProgress.Load() != nil {
+		t.Error("expected progress cleared after crawl")
+	}
+	var summary map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var event map[string]interface{}
+		if err := dec.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		if event["msg"] == "crawl summary" {
+			summary = event
+		}
+	}
+	if summary == nil {
+		t.Fatal("expected crawl summary")
+	}
+	// the first interval is dropped along with the timed out second one.
+	if summary["done"] != 4.0 || summary["failed"] != 2.0 || summary["left"] != 0.0 {
+		t.Errorf("unexpected summary %v", summary)
+	}
+	for _, key := range []string{"calcP50", "calcP90", "calcP99", "downloadP50", "downloadP90", "downloadP99"} {
+		if _, ok := summary[key]; !ok {
+			t.Errorf("expected %s in summary %v", key, summary)
+		}
+	}
+}
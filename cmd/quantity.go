@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Output quantities selected with output.quantity. Spectraplot calculates
+// absorbance A = -ln(I/I0), which the others are derived from.
+const (
+	quantityAbsorbance            = "absorbance"
+	quantityTransmittance         = "transmittance"
+	quantityAbsorptionCoefficient = "absorptionCoefficient"
+	quantityCrossSection          = "crossSection"
+)
+
+// quantityUnits are the units output quantities are written in. Units hold
+// no slash as they are written among the slash separated conditions.
+var quantityUnits = map[string]string{
+	quantityAbsorbance:            "1",
+	quantityTransmittance:         "1",
+	quantityAbsorptionCoefficient: "cm-1",
+	quantityCrossSection:          "cm2 molecule-1",
+}
+
+const (
+	boltzmann = 1.380649e-23 // [J/K]
+	atm       = 101325.0     // [Pa]
+)
+
+// outputQuantity returns output.quantity, absorbance if not set.
+func outputQuantity() string {
+	if q := viper.GetString("output.quantity"); q != "" {
+		return q
+	}
+	return quantityAbsorbance
+}
+
+func checkQuantity(quantity string) error {
+	if _, ok := quantityUnits[quantity]; !ok {
+		return fmt.Errorf("unknown quantity %q. expected %s, %s, %s or %s", quantity,
+			quantityAbsorbance, quantityTransmittance, quantityAbsorptionCoefficient, quantityCrossSection)
+	}
+	return nil
+}
+
+// quantityMeta returns the header metadata stating quantity and its unit.
+func quantityMeta(quantity string) []string {
+	return []string{"quantity=" + quantity, "unit=" + quantityUnits[quantity]}
+}
+
+// numberDensity returns the number density [molecule/cm3] of the absorbing
+// species of c, an ideal gas at mole fraction x, T and P.
+func numberDensity(c spectraConditions) float64 {
+	return c.Ppm * 1e-6 * c.P * atm / (boltzmann * c.T) * 1e-6
+}
+
+// fromAbsorbance converts absorbance a of a spectrum with conditions c to quantity.
+func fromAbsorbance(a float64, quantity string, c spectraConditions) (float64, error) {
+	switch quantity {
+	case quantityAbsorbance:
+		return a, nil
+	case quantityTransmittance:
+		return math.Exp(-a), nil
+	case quantityAbsorptionCoefficient:
+		return a / c.L, nil
+	case quantityCrossSection:
+		if len(c.mixture) > 0 {
+			return 0, fmt.Errorf("%s of mixture %s is undefined. crawl its species on their own", quantity, c.gasID)
+		}
+		return a / (numberDensity(c) * c.L), nil
+	}
+	return 0, checkQuantity(quantity)
+}
+
+// toAbsorbance converts v of quantity of a spectrum with conditions c back to absorbance.
+func toAbsorbance(v float64, quantity string, c spectraConditions) (float64, error) {
+	switch quantity {
+	case quantityAbsorbance:
+		return v, nil
+	case quantityTransmittance:
+		return -math.Log(v), nil
+	case quantityAbsorptionCoefficient:
+		return v * c.L, nil
+	case quantityCrossSection:
+		if len(c.mixture) > 0 {
+			return 0, fmt.Errorf("%s of mixture %s is undefined", quantity, c.gasID)
+		}
+		return v * numberDensity(c) * c.L, nil
+	}
+	return 0, checkQuantity(quantity)
+}
+
+// convertValue converts the CSV value s of a spectrum with conditions c
+// from one quantity to another. s is returned as is if from equals to.
+func convertValue(s, from, to string, c spectraConditions) (string, error) {
+	if from == to {
+		return s, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", err
+	}
+	if v, err = toAbsorbance(v, from, c); err != nil {
+		return "", err
+	}
+	if v, err = fromAbsorbance(v, to, c); err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64), nil
+}
+
+// convertFile writes the output file name converted to quantity into dir
+// and returns the name of the written file. The quantity of name is read
+// from its header, absorbance if not stated, and each column is converted
+// with the conditions in its header.
+func convertFile(name, dir, quantity string) (string, error) {
+	fi, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fi.Close()
+	records, err := csv.NewReader(fi).ReadAll()
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 || len(records[0]) < 2 || records[0][0] != "nu" {
+		return "", fmt.Errorf("%s: not a spectracrawl output file", name)
+	}
+	header := records[0]
+	from := quantityAbsorbance
+	conditions := make([]spectraConditions, len(header))
+	for j := 1; j < len(header); j++ {
+		var kept []string
+		for _, field := range strings.Split(header[j], "/") {
+			switch {
+			case strings.HasPrefix(field, "quantity="):
+				from = strings.TrimPrefix(field, "quantity=")
+			case strings.HasPrefix(field, "unit="):
+			default:
+				kept = append(kept, field)
+			}
+		}
+		if err = checkQuantity(from); err != nil {
+			return "", fmt.Errorf("%s: %s", name, err)
+		}
+		if conditions[j], err = parseSpectraConditions(kept); err != nil {
+			return "", fmt.Errorf("%s: %s", name, err)
+		}
+		if j == 1 {
+			kept = append(kept, quantityMeta(quantity)...)
+		}
+		header[j] = strings.Join(kept, "/")
+	}
+	for i, record := range records[1:] {
+		for j := 1; j < len(record) && j < len(header); j++ {
+			if record[j], err = convertValue(record[j], from, quantity, conditions[j]); err != nil {
+				return "", fmt.Errorf("%s: line %d. %s", name, i+2, err)
+			}
+		}
+	}
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	outputName := filepath.Join(dir, quantityFilename(filepath.Base(name), quantity))
+	err = writeCSVFile(outputName, func(w *csv.Writer) error { return w.WriteAll(records) })
+	if err != nil {
+		return "", err
+	}
+	return outputName, nil
+}
+
+var convertFlags struct {
+	quantity, dir string
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert [files]",
+	Short: "Converts output files to another quantity, i.e. transmittance",
+	Long: `Converts output files to another quantity, i.e. transmittance
+
+Quantities are absorbance, transmittance exp(-A), absorptionCoefficient
+A/L [cm-1] and crossSection A/(nL) [cm2/molecule] where n is the number
+density of the species at the x, T and P in the file header. Files are
+read in the quantity stated in their header and written to --dir, by
+default a directory named after the quantity next to each file.
+`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkQuantity(convertFlags.quantity); err != nil {
+			return err
+		}
+		for _, name := range args {
+			dir := convertFlags.dir
+			if dir == "" {
+				dir = filepath.Join(filepath.Dir(name), convertFlags.quantity)
+			}
+			outputName, err := convertFile(name, dir, convertFlags.quantity)
+			if err != nil {
+				return err
+			}
+			logf("[inf] wrote %s", outputName)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().StringVar(&convertFlags.quantity, "quantity", quantityTransmittance, "quantity to convert to")
+	convertCmd.Flags().StringVar(&convertFlags.dir, "dir", "", "directory to write converted files to")
+}
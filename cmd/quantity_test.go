@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestQuantityConversion(t *testing.T) {
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}
+	// 1 ppm of an ideal gas at 300 K and 1 atm.
+	if n := numberDensity(c); math.Abs(n/2.44631e13-1) > 1e-5 {
+		t.Errorf("expected number density 2.44631e13 molecule/cm3, got %g", n)
+	}
+	const a = 0.5
+	for _, test := range []struct {
+		quantity string
+		want     float64
+	}{
+		{quantityAbsorbance, a},
+		{quantityTransmittance, math.Exp(-a)},
+		{quantityAbsorptionCoefficient, a / 100},
+		{quantityCrossSection, a / (numberDensity(c) * 100)},
+	} {
+		got, err := fromAbsorbance(a, test.quantity, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got/test.want-1) > 1e-12 {
+			t.Errorf("%s: expected %g, got %g", test.quantity, test.want, got)
+		}
+		back, err := toAbsorbance(got, test.quantity, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(back-a) > 1e-12 {
+			t.Errorf("%s: expected absorbance %g back, got %g", test.quantity, a, back)
+		}
+	}
+	mix := spectraConditions{T: 300, P: 1, L: 100, gasID: "H2O_CO2", mixture: parseMixtureName("H2O_CO2")}
+	if _, err := fromAbsorbance(a, quantityCrossSection, mix); err == nil {
+		t.Error("expected error for cross-section of mixture")
+	}
+	if _, err := fromAbsorbance(a, "absorptance", c); err == nil {
+		t.Error("expected error for unknown quantity")
+	}
+}
+
+func TestCrawlQuantity(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	viper.Set("HITRAN.endNu", 1300.0)
+	viper.Set("output.quantity", quantityAbsorptionCoefficient)
+	d := &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}
+	name := filepath.Join(outDir, generateFilename(c, [2]float64{1000, 1300}))
+	if !strings.HasSuffix(name, ",L=100cm,quantity=absorptionCoefficient.csv") {
+		t.Fatalf("expected quantity in file name, got %s", name)
+	}
+	coef := readQuantityFile(t, name)
+	if !strings.HasSuffix(coef[0][1], "/quantity=absorptionCoefficient/unit=cm-1") {
+		t.Fatalf("expected quantity in header, got %q", coef[0][1])
+	}
+	converted, err := convertFile(name, filepath.Join(outDir, quantityAbsorbance), quantityAbsorbance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(converted) != "nu=1000-1300,CH4,x=1e-06,T=300K,P=1atm,L=100cm.csv" {
+		t.Errorf("expected absorbance named without quantity, got %s", converted)
+	}
+	abs := readQuantityFile(t, converted)
+	if abs[0][1] != conditionString(c)+"/quantity=absorbance/unit=1" {
+		t.Errorf("unexpected converted header %q", abs[0][1])
+	}
+	if len(abs) != len(coef) || len(abs) < 2 {
+		t.Fatalf("expected %d converted records, got %d", len(coef), len(abs))
+	}
+	for i := 1; i < len(abs); i++ {
+		a, _ := strconv.ParseFloat(abs[i][1], 64)
+		alpha, _ := strconv.ParseFloat(coef[i][1], 64)
+		if abs[i][0] != coef[i][0] || math.Abs(a-alpha*c.L) > 1e-12 {
+			t.Fatalf("record %d: absorbance %s does not match absorption coefficient %s", i, abs[i][1], coef[i][1])
+		}
+	}
+	// files of another quantity are not skipped as existing.
+	viper.Set("output.quantity", quantityTransmittance)
+	d = &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Calculated) != 3 {
+		t.Errorf("expected transmittance calculated next to absorption coefficient, got %d calculations", len(d.Calculated))
+	}
+	reports, err := spectraCoverage(outDir, 1000, 1300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[0].Duplicated != 0 || reports[1].Duplicated != 0 {
+		t.Errorf("expected coverage of each quantity on its own, got %+v", reports)
+	}
+}
+
+func TestConvertFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "nu=1000-1001,CH4,x=1e-06,T=300K,P=1atm,L=100cm.csv")
+	data := "nu,CH4/x=1e-6/T=300K/P=1atm/L=100cm\n1000,0.5\n1001,bad\n"
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(dir, quantityTransmittance)
+	if _, err := convertFile(name, outDir, quantityTransmittance); err == nil {
+		t.Fatal("expected error converting a bad value")
+	}
+	if entries, _ := os.ReadDir(outDir); len(entries) != 0 {
+		t.Errorf("expected no converted file left behind, got %s", entries[0].Name())
+	}
+}
+
+func readQuantityFile(t *testing.T, name string) [][]string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
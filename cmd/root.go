@@ -16,16 +16,23 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	wd "github.com/fedesog/webdriver"
-	homedir "github.com/mitchellh/go-homedir"
-	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"log/slog"
+	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -34,17 +41,78 @@ var (
 	ErrDanger         = fmt.Errorf("spectracrawl: danger message popup encountered")
 	ErrDownloadedFile = fmt.Errorf("spectracrawl: downloaded file missing or corrupt")
 	ErrNoData         = fmt.Errorf("spectracrawl: no data to download available")
+	ErrFormMismatch   = fmt.Errorf("spectracrawl: page form does not hold requested conditions")
+	// ErrDownloadTimeout is returned when the download of a batch does not
+	// show up in time. Unlike ErrTimeout it does not shrink intervals.
+	ErrDownloadTimeout = fmt.Errorf("spectracrawl: download timeout")
+	// ErrConditionMismatch is returned when downloaded spectra were not
+	// calculated with the requested conditions.
+	ErrConditionMismatch = fmt.Errorf("spectracrawl: downloaded spectra conditions differ from requested")
 )
 
-var logFile *os.File
-
 type spectraConditions struct {
 	T, P, L, NuStart, NuEnd, NuStep, Ppm float64
 	gasID                                string
+	// database is the line database of gasID, empty for HITRAN.
+	database string
+	// Telec is the electronic temperature [K] of NIST atomic spectra.
+	Telec float64
+	// mixture holds the species filling the species slots of a gas mixture.
+	// gasID is then the mixture name and Ppm is unused.
+	mixture []mixtureSpecies
+}
+
+// Config sections holding the species and conditions crawled.
+const (
+	hitranSection = "HITRAN"
+	nistSection   = "NIST"
+)
+
+// configSection is the config section read by the crawl. It is
+// nistSection for the nist command and hitranSection otherwise.
+var configSection = hitranSection
+
+// sectionKey returns key in configSection, i.e. HITRAN.stepNu.
+func sectionKey(key string) string { return configSection + "." + key }
+
+// allSections is set by commands working on every configured section, such
+// as resume, instead of configSection alone.
+var allSections bool
+
+// configuredSections returns the config sections listing species, HITRAN
+// first. It returns the HITRAN section if none do.
+func configuredSections() (sections []string) {
+	for _, section := range []string{hitranSection, nistSection} {
+		if viper.IsSet(section+".gasID") || viper.IsSet(section+".mixture") {
+			sections = append(sections, section)
+		}
+	}
+	if len(sections) == 0 {
+		return []string{hitranSection}
+	}
+	return sections
+}
+
+// sectionOf returns the config section crawling species of database.
+func sectionOf(database string) string {
+	if database == dbNIST {
+		return nistSection
+	}
+	return hitranSection
+}
+
+// inSection calls fn with configSection set to section.
+func inSection(section string, fn func() error) error {
+	defer func(prev string) { configSection = prev }(configSection)
+	configSection = section
+	return fn()
 }
 
 var cfgFile string
 
+// cfgErr is the error finding the config file, returned by configArgs.
+var cfgErr error
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "spectracrawl",
@@ -60,203 +128,536 @@ Code is open source and protected by Apache license 2.0
 Code and example config file at:
 http://github.com/soypat/spectracrawl
 `,
-	Args: func(cmd *cobra.Command, args []string) error {
-		err := checkConfig()
-		if err != nil {
-			logf("[err] error in config. %s", err)
-		}
-		return err
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-		defer logFile.Close()
-		log("[inf] starting program")
-		if err := runner(args); err != nil {
-			logf("[err] %s", err)
-			//time.Sleep(time.Second * 10)
-			os.Exit(1)
-		}
+	Args: configArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCommand(cmd, "[inf] starting program", func(ctx context.Context) error { return runner(ctx, args) })
 	},
 }
 
+// loggedError is an error already logged, which Execute does not print again.
+type loggedError struct{ error }
+
+// configArgs loads and sanitizes the configuration for commands that crawl.
+func configArgs(cmd *cobra.Command, args []string) error {
+	if cfgErr != nil {
+		return cfgErr
+	}
+	if err := checkConfig(); err != nil {
+		logf("[err] error in config. %s", err)
+		return loggedError{err}
+	}
+	return nil
+}
+
 const fpsep = string(filepath.Separator)
 
 const (
 	maxWaveNumber = 47365.0
 	maxTemp       = 4e12
 	minNuStep     = 0.01
+	// minRetryRange is the smallest interval [cm-1] retries split down to
+	// unless adaptive sizing sets its own, see retryMinRange.
+	minRetryRange = 1.0
 )
 const urlStart = "http://www.spectraplot.com/absorption"
 
-func runner(_ []string) error {
-	chromeDriver := wd.NewChromeDriver(viper.GetString("browser.driverPath"))
-	downloadPath := viper.GetString("browser.downloadDir")
-	downloadedFileName := downloadPath + fpsep + defaultZipName
-	err := chromeDriver.Start()
+func runner(ctx context.Context, _ []string) error {
+	drivers, err := startWebDrivers()
+	if err != nil {
+		return err
+	}
+	defer closeDrivers(drivers)
+	return crawl(ctx, drivers...)
+}
+
+// runCommand runs fn of cmd with a context canceled on SIGINT or SIGTERM so
+// that batches in progress are abandoned, the manifest saved and browser
+// sessions closed before returning. A second signal exits right away. The
+// error of fn is logged and returned for Execute to exit with.
+func runCommand(cmd *cobra.Command, start string, fn func(ctx context.Context) error) error {
+	cmd.SilenceUsage = true // arguments were fine by now.
+	defer closeLog()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop() // restore default handling so a second signal kills the process.
+	}()
+	log(start)
+	if addr := viper.GetString("metrics.listen"); addr != "" {
+		srv, err := serveMetrics(addr)
+		if err != nil {
+			logf("[err] %s", err)
+			return loggedError{err}
+		}
+		defer srv.Close()
+	}
+	err := fn(ctx)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		log("[inf] interrupted. progress saved to manifest, run resume to continue")
+	} else {
+		logf("[err] %s", err)
+	}
+	return loggedError{err}
+}
+
+// crawl splits the configured wavenumber range into batches of intervals
+// and has drivers calculate and download the batches into the gas's output
+// directory for every crawl job of the sweeps. Progress is recorded in the
+// job manifest.
+func crawl(ctx context.Context, drivers ...SpectraplotDriver) error {
+	m, err := loadManifest(manifestPath())
 	if err != nil {
 		return err
 	}
-	var session *wd.Session
-	desired := wd.Capabilities{"Platform": "Windows"}
-	required := wd.Capabilities{"Platform": "Windows"}
-	session, err = chromeDriver.NewSession(desired, required)
+	jobs, err := crawlJobs()
 	if err != nil {
 		return err
 	}
-	defer session.CloseCurrentWindow()
-	defer session.Delete()
-	if err = session.Url(urlStart); err != nil {
+	startNu, endNu := viper.GetFloat64(sectionKey("startNu")), viper.GetFloat64(sectionKey("endNu"))
+	defer startProgress().finish()
+	for i, c := range jobs {
+		if len(jobs) > 1 {
+			logf("[inf] starting job %d/%d: %s", i+1, len(jobs), conditionString(c))
+		}
+		if viper.GetBool("spectraplot.adaptive.enabled") {
+			err = crawlAdaptive(ctx, drivers, m, c, startNu, endNu)
+		} else {
+			err = crawlIntervals(ctx, drivers, m, c, nuIntervals(startNu, endNu, gasMaxRange(c.species())), nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	log("[inf] finish program")
+	return nil
+}
+
+// crawlIntervals calculates intervals in batches of at most
+// spectraplot.maxNumberOfPlots contiguous intervals. Failed intervals are
+// retried up to spectraplot.retries times with exponential backoff.
+// Returns ctx.Err() once ctx is done, leaving abandoned intervals pending.
+// Calculations are reported to sizer if not nil, and timed out intervals
+// are then split on retry too. The manifest is saved on returning.
+func crawlIntervals(ctx context.Context, drivers []SpectraplotDriver, m *manifest, c spectraConditions, intervals [][2]float64, sizer *intervalSizer) (err error) {
+	job := conditionString(c)
+	for _, interval := range intervals {
+		m.chunk(job, interval)
+	}
+	defer func() {
+		if saveErr := m.save(); err == nil {
+			err = saveErr
+		}
+	}()
+	if err := m.saveEvery(manifestSaveInterval); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputDirFor(c.species()), os.ModePerm); err != nil {
 		return err
 	}
-	startNu, endNu := viper.GetFloat64("HITRAN.startNu"), viper.GetFloat64("HITRAN.endNu")
-	intervals := nuIntervals(startNu, endNu)
-	_ = os.Remove(downloadedFileName) // delete any previous spectraplot file if present
-	jobQuantity := viper.GetInt("spectraplot.maxNumberOfPlots")
-	for jobNumber := jobQuantity; jobNumber < len(intervals)+jobQuantity; jobNumber += jobQuantity {
-		if jobNumber > len(intervals) {
-			jobNumber = len(intervals)
+	crawlProgress.Load().addJob(c, len(intervals))
+	limiter := &rateLimiter{every: time.Duration(viper.GetFloat64("spectraplot.rateLimit_s") * float64(time.Second))}
+	workers := make([]*worker, len(drivers))
+	for i, d := range drivers {
+		workers[i] = &worker{id: i + 1, d: d, limiter: limiter, sizer: sizer}
+	}
+	retries := viper.GetInt("spectraplot.retries")
+	for retry := 0; len(intervals) > 0; retry++ {
+		failed, err := crawlBatches(ctx, workers, m, c, intervals)
+		if err != nil {
+			return err
+		}
+		if len(failed) > 0 && retry >= retries {
+			for _, interval := range failed {
+				chunk := m.chunk(job, interval)
+				logEvent(slog.LevelError, "gap in spectra after retries", append(jobFields(c, interval, chunk.Attempts, 0), "err", chunk.LastError)...)
+			}
+			break
+		}
+		intervals = nil
+		for _, interval := range failed {
+			err := m.chunk(job, interval).err
+			split := viper.GetBool("spectraplot.retrySplit") || shrinksRange(err) || (sizer != nil && errors.Is(err, ErrTimeout))
+			if !split || interval[1]-interval[0] < 2*retryMinRange() {
+				intervals = append(intervals, interval)
+				continue
+			}
+			m.chunk(job, interval).Status = chunkSplit
+			mid := (interval[0] + interval[1]) / 2
+			intervals = append(intervals, [2]float64{interval[0], mid}, [2]float64{mid, interval[1]})
+			m.chunk(job, [2]float64{interval[0], mid})
+			m.chunk(job, [2]float64{mid, interval[1]})
 		}
-		var processInterval [][2]float64
-		if len(intervals) < jobQuantity { // boundary case:
-			processInterval = intervals[0:jobNumber]
-		} else { //usual case:
-			processInterval = intervals[jobNumber-jobQuantity : jobNumber]
+		crawlProgress.Load().retry(len(failed), len(intervals))
+		if len(intervals) > 0 {
+			wait := retryBackoff(retry)
+			logf("[inf] retrying %d failed intervals in %s (retry %d/%d)", len(intervals), wait, retry+1, retries)
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
 		}
+	}
+	return nil
+}
+
+// crawlBatches spreads batches of intervals over workers through a work queue
+// and returns the intervals that could not be calculated or downloaded.
+// The manifest is only updated from the calling goroutine. Batches are no
+// longer handed out once ctx is done or a fatal error is met, and those
+// abandoned midway are left pending in the manifest.
+func crawlBatches(ctx context.Context, workers []*worker, m *manifest, c spectraConditions, intervals [][2]float64) (failed [][2]float64, _ error) {
+	job := conditionString(c)
+	var batches []queuedBatch
+	for _, processInterval := range batchIntervals(intervals, viper.GetInt("spectraplot.maxNumberOfPlots")) {
+		batchSpan := [2]float64{processInterval[0][0], processInterval[len(processInterval)-1][1]}
 		if !viper.GetBool("output.replaceExisting") {
-			expectedFilename := generateFilename(spectraConditions{
-				T:     viper.GetFloat64("HITRAN.T"),
-				P:     viper.GetFloat64("HITRAN.p"),
-				L:     viper.GetFloat64("HITRAN.L"),
-				Ppm:   viper.GetFloat64("HITRAN.ppm"),
-				gasID: viper.GetString("HITRAN.gasID"),
-			}, [2]float64{processInterval[0][0], processInterval[len(processInterval)-1][1]})
-			if _, err := os.Stat(viper.GetString("output.dir") + fpsep + expectedFilename); !os.IsNotExist(err) {
+			expectedFilename := generateFilename(c, batchSpan)
+			if _, err := os.Stat(outputDirFor(c.species()) + fpsep + expectedFilename); !os.IsNotExist(err) {
 				logf("[inf] file exists. skipping %s", expectedFilename)
+				for _, interval := range processInterval {
+					m.chunk(job, interval).markDone(expectedFilename)
+				}
+				crawlProgress.Load().skip(len(processInterval))
 				continue // file exists and we do not want to replace existing, skip work
 			}
 		}
-		err := makeFile(session, processInterval)
-		if err == ErrDownloadedFile {
-			continue
-		} else if err == ErrPageScan {
-			logf("[err] page not loaded correctly. reloading page and skipping interval")
-			err := session.Url(urlStart)
-			if err != nil {
-				return err
+		attempt := 0
+		for _, interval := range processInterval {
+			if n := m.chunk(job, interval).Attempts; n > attempt {
+				attempt = n
 			}
-			continue
-		} else if err == ErrNoData{
-			logf("[err] no data to download in interval [%.f-%.f]",processInterval[0][0],processInterval[len(processInterval)-1][1])
-			continue
-		} else if err != nil {
-			return err
 		}
-		logf("[scp] file downloaded. finished %d/%d", jobNumber, len(intervals))
+		batches = append(batches, queuedBatch{intervals: processInterval, attempt: attempt + 1})
 	}
-	log("[inf] finish program")
-	return nil
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue := make(chan queuedBatch)
+	results := make(chan batchResult)
+	go func() {
+		defer close(queue)
+		for _, batch := range batches {
+			select {
+			case queue <- batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			for batch := range queue {
+				r := w.crawlBatch(ctx, c, batch)
+				if r.err != nil && !recoverable(r.err) {
+					cancel() // before taking another batch.
+				}
+				results <- r
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	var fatal error
+	finished := 0
+	for r := range results {
+		if r.err != nil && ctx.Err() != nil && (recoverable(r.err) || errors.Is(r.err, ctx.Err())) {
+			continue // abandoned batch.
+		}
+		finished += len(r.intervals)
+		failedBefore := len(failed)
+		for i, interval := range r.intervals {
+			chunk := m.chunk(job, interval)
+			chunk.Attempts++
+			if r.calcErrs[i] != nil {
+				chunk.markFailed(r.calcErrs[i])
+			} else if r.err != nil {
+				chunk.markFailed(r.err)
+			} else {
+				chunk.markDone(r.file)
+				intervalsSucceeded.add(1)
+				continue
+			}
+			failed = append(failed, interval)
+		}
+		crawlProgress.Load().finishBatch(len(r.intervals), len(failed)-failedBefore)
+		if err := m.saveEvery(manifestSaveInterval); err != nil && fatal == nil {
+			fatal = err
+		}
+		switch {
+		case r.err == nil:
+			span := [2]float64{r.intervals[0][0], r.intervals[len(r.intervals)-1][1]}
+			fields := append([]interface{}{"worker", r.worker.id}, jobFields(c, span, r.attempt, r.duration)...)
+			logEvent(slog.LevelInfo, "file downloaded", append(fields, "file", r.file, "finished", finished, "total", len(intervals))...)
+		case !recoverable(r.err) && fatal == nil:
+			fatal = r.err
+		}
+	}
+	if fatal == nil {
+		fatal = ctx.Err()
+	}
+	if fatal != nil {
+		return nil, fatal
+	}
+	return failed, nil
 }
 
-func makeFile(s *wd.Session, intervals [][2]float64) error {
-	downloadedFileName := viper.GetString("browser.downloadDir") + fpsep + defaultZipName
-	plotCount := 0
-	_ = leftClickSelector(s, `#clear`)
-	for _, interval := range intervals {
-		err := setHitran(s, spectraConditions{
-			T:       viper.GetFloat64("HITRAN.T"),
-			P:       viper.GetFloat64("HITRAN.p"),
-			L:       viper.GetFloat64("HITRAN.L"),
-			NuStart: interval[0],
-			NuEnd:   interval[1],
-			NuStep:  viper.GetFloat64("HITRAN.stepNu"),
-			Ppm:     viper.GetFloat64("HITRAN.ppm"),
-			gasID:   viper.GetString("HITRAN.gasID"),
-		})
-		if err == ErrPageScan {
-			return ErrPageScan
+// recoverable reports whether a batch failing with err can be retried.
+func recoverable(err error) bool {
+	switch err {
+	case ErrDownloadedFile, ErrDownloadTimeout, ErrPageScan, ErrNoData, ErrFormMismatch, ErrConditionMismatch:
+		return true
+	}
+	return false
+}
+
+// crawlBatch makes the file of a single batch, reloading the page on
+// ErrPageScan and ErrFormMismatch.
+func (w *worker) crawlBatch(ctx context.Context, c spectraConditions, b queuedBatch) batchResult {
+	w.attempt = b.attempt
+	start := time.Now()
+	file, calcErrs, err := makeFile(ctx, w, c, b.intervals)
+	r := batchResult{worker: w, intervals: b.intervals, attempt: b.attempt, duration: time.Since(start), file: file, calcErrs: calcErrs, err: err}
+	span := [2]float64{b.intervals[0][0], b.intervals[len(b.intervals)-1][1]}
+	if ctx.Err() != nil {
+		return r
+	}
+	// each failed interval is counted once, by the error the manifest
+	// records for it.
+	for i := range b.intervals {
+		if i < len(calcErrs) && calcErrs[i] != nil {
+			countErr(calcErrs[i], 1)
 		} else if err != nil {
-			return err
+			countErr(err, 1)
 		}
-		time.Sleep(time.Duration(viper.GetInt("spectraplot.calcDelay_s")) * time.Second)
-		logf("[scp] calculating nu=[%.f-%.f] for %s", interval[0], interval[1], viper.GetString("HITRAN.gasID"))
-		_ = leftClickSelector(s, `#calculate_hitran`)
-		err = waitForCalculation(s)
-		if err == ErrTimeout {
-			log("[warn] calc timeout! dropping data and resuming work")
-			_ = leftClickSelector(s, `#clear`)
-			plotCount = 0
-			continue
-		} else if err == ErrDanger {
-			log("[warn] calc error! dropping data and try to resume")
-			_ = leftClickSelector(s, `#clear`)
-			plotCount = 0
-			continue
-		} else if err != nil {
-			return err
+	}
+	if err == ErrPageScan || err == ErrFormMismatch {
+		w.logJob("err", "page not loaded correctly. reloading page and requeueing interval", c, span, r.duration, "err", err)
+		if reloadErr := w.d.Reload(); reloadErr != nil {
+			r.err = reloadErr
+		}
+	} else if err == ErrNoData {
+		w.logJob("err", "no data to download in interval", c, span, r.duration)
+	} else if err == ErrConditionMismatch {
+		w.logJob("err", "downloaded spectra do not match requested conditions. reloading page and requeueing interval", c, span, r.duration)
+		if reloadErr := w.d.Reload(); reloadErr != nil {
+			r.err = reloadErr
 		}
-		plotCount++
 	}
-	if plotCount == 0 {
-		return ErrNoData
+	return r
+}
+
+// retryBackoff returns the wait before the given retry, starting at
+// spectraplot.backoffBase_s and doubling up to spectraplot.backoffCap_s.
+func retryBackoff(retry int) time.Duration {
+	wait := viper.GetFloat64("spectraplot.backoffBase_s") * math.Pow(2, float64(retry))
+	if limit := viper.GetFloat64("spectraplot.backoffCap_s"); wait > limit {
+		wait = limit
 	}
-	_ = leftClickSelector(s, `#data`)
-	err := waitForDownload(downloadedFileName)
-	_ = leftClickSelector(s, `#clear`)
-	err = processSpectra(downloadedFileName, viper.GetString("output.dir"))
+	return time.Duration(wait * float64(time.Second))
+}
+
+// makeFile calculates intervals with conditions c as a single batch and merges the downloaded
+// spectra into a file in the output directory whose name is returned. calcErrs holds
+// the error of each interval left out of the batch, nil for those present
+// in the file.
+func makeFile(ctx context.Context, w *worker, c spectraConditions, intervals [][2]float64) (file string, calcErrs []error, err error) {
+	if len(c.mixture) > 0 {
+		return makeMixtureFile(ctx, w, c, intervals)
+	}
+	downloadedFileName, calcErrs, err := plotBatch(ctx, w, c, intervals)
 	if err != nil {
-		logf("[warn] an error ocurred processing interval [%.f-%.f]. %s", intervals[0][0], intervals[len(intervals)-1][1], err)
+		return "", calcErrs, err
+	}
+	var plotted [][2]float64
+	for i, calcErr := range calcErrs {
+		if calcErr == nil {
+			plotted = append(plotted, intervals[i])
+		}
 	}
-	err = os.Remove(downloadedFileName)
+	file, err = processSpectra(downloadedFileName, outputDirFor(c.species()), c, plotted)
 	if err != nil {
-		logf("[inf] fail downloaded file removal. %s", err)
-		return ErrDownloadedFile
+		w.logJob("warn", "an error ocurred processing interval", c, [2]float64{intervals[0][0], intervals[len(intervals)-1][1]}, 0, "err", err)
 	}
-	return nil
+	if rmErr := os.Remove(downloadedFileName); rmErr != nil {
+		w.logf("inf", "fail downloaded file removal. %s", rmErr)
+		return "", calcErrs, ErrDownloadedFile
+	}
+	if err != nil {
+		return "", calcErrs, processingErr(err)
+	}
+	return file, calcErrs, nil
 }
 
-func waitForDownload(downloadName string) error {
-	downloaded := false
-	timeout := false
-	var err error
-	go func() {
-		time.Sleep(time.Duration(viper.GetInt("output.timeout_s")) * time.Second)
-		timeout = true
+// processingErr returns ErrConditionMismatch if err is one and
+// ErrDownloadedFile otherwise.
+func processingErr(err error) error {
+	if errors.Is(err, ErrConditionMismatch) {
+		return ErrConditionMismatch
+	}
+	return ErrDownloadedFile
+}
+
+// makeMixtureFile calculates intervals for the mixture c and for each of its
+// species alone, and merges the downloads into a file holding the combined
+// spectrum followed by a column per species. Intervals are only written
+// if every calculation of the batch succeeds.
+func makeMixtureFile(ctx context.Context, w *worker, c spectraConditions, intervals [][2]float64) (file string, calcErrs []error, err error) {
+	var zips []string
+	defer func() {
+		for _, zip := range zips {
+			if rmErr := os.Remove(zip); rmErr != nil {
+				w.logf("inf", "fail downloaded file removal. %s", rmErr)
+			}
+		}
 	}()
-	for !downloaded {
-		_, err = os.Stat(downloadName)
-		if os.IsNotExist(err) {
-			time.Sleep(100 * time.Millisecond)
-		} else {
-			downloaded = true
+	downloads := append([]spectraConditions{c}, c.components()...)
+	for i, component := range downloads {
+		downloadedFileName, calcErrs, err := plotBatch(ctx, w, component, intervals)
+		if err != nil {
+			return "", calcErrs, err
 		}
-		if timeout {
-			return ErrTimeout
+		zips = append(zips, downloadedFileName)
+		var dropped error
+		for _, calcErr := range calcErrs {
+			if dropped == nil {
+				dropped = calcErr
+			}
+		}
+		if dropped != nil {
+			for j := range calcErrs {
+				if calcErrs[j] == nil {
+					calcErrs[j] = fmt.Errorf("mixture batch dropped after %s", dropped)
+				}
+			}
+			return "", calcErrs, ErrNoData
 		}
+		// keep the download from being overwritten by the next one.
+		zip := fmt.Sprintf("%s.%d", downloadedFileName, i)
+		if err = os.Rename(downloadedFileName, zip); err != nil {
+			return "", calcErrs, ErrDownloadedFile
+		}
+		zips[len(zips)-1] = zip
 	}
-	return err
+	file, err = processMixture(zips, outputDirFor(c.species()), downloads, intervals)
+	if err != nil {
+		w.logJob("warn", "an error ocurred processing interval", c, [2]float64{intervals[0][0], intervals[len(intervals)-1][1]}, 0, "err", err)
+		return "", make([]error, len(intervals)), processingErr(err)
+	}
+	return file, make([]error, len(intervals)), nil
 }
 
-func checkConfig() error {
-	if viper.GetBool("log.toFile") {
-		fo, err := os.Create("spectracrawl.log")
+// plotBatch calculates intervals with conditions c and downloads the plots.
+// calcErrs holds the error of each interval missing from the download.
+// The batch is abandoned with ctx.Err() once ctx is done.
+func plotBatch(ctx context.Context, w *worker, c spectraConditions, intervals [][2]float64) (downloadedFileName string, calcErrs []error, err error) {
+	d := w.d
+	calcErrs = make([]error, len(intervals))
+	var plotted []int
+	_ = d.Clear()
+	for i, interval := range intervals {
+		c.NuStart, c.NuEnd = interval[0], interval[1]
+		if err = d.SetConditions(c); err != nil {
+			return "", calcErrs, err
+		}
+		for slot, s := range c.slots() {
+			if err = d.SelectSpecies(slot+1, s.gasID, s.database); err != nil {
+				return "", calcErrs, err
+			}
+		}
+		if err = sleep(ctx, time.Duration(viper.GetInt("spectraplot.calcDelay_s"))*time.Second); err != nil {
+			return "", calcErrs, err
+		}
+		if err = w.limiter.wait(ctx); err != nil {
+			return "", calcErrs, err
+		}
+		w.logJob("dbg", "calculating", c, interval, 0)
+		start := time.Now()
+		intervalsAttempted.add(1)
+		err = d.Calculate(ctx)
+		w.sizer.observe(interval, time.Since(start), err)
+		if err == nil {
+			crawlProgress.Load().calculated(time.Since(start))
+			w.logJob("scp", "calculated", c, interval, time.Since(start))
+		} else if errors.Is(err, ErrMoleFraction) {
+			// every interval of the crawl would fail alike.
+			return "", calcErrs, err
+		} else if errors.Is(err, ErrTimeout) {
+			w.logJob("warn", "calc timeout! dropping data and resuming work", c, interval, time.Since(start))
+		} else if errors.Is(err, ErrDanger) {
+			w.logJob("warn", "calc error! dropping data and try to resume", c, interval, time.Since(start), "err", err)
+		} else if err != nil {
+			return "", calcErrs, err
+		}
 		if err != nil {
-			return err
+			_ = d.Clear()
+			calcErrs[i] = err
+			for _, j := range plotted {
+				calcErrs[j] = fmt.Errorf("plot cleared after %s", err)
+			}
+			plotted = plotted[:0]
+			continue
 		}
-		logFile = fo
+		plotted = append(plotted, i)
 	}
-	log("[inf] start program")
-	// OVERRIDES
-	if gasFlag != "" {
-		viper.Set("HITRAN.gasID", gasFlag)
+	if len(plotted) == 0 {
+		return "", calcErrs, ErrNoData
 	}
-	if nuSFlag >= 0 {
-		viper.Set("HITRAN.startNu", nuSFlag)
+	start := time.Now()
+	downloadedFileName, err = d.Download(ctx)
+	_ = d.Clear()
+	if ctx.Err() != nil {
+		return "", calcErrs, ctx.Err()
+	} else if err == ErrTimeout {
+		w.logJob("warn", "download timeout", c, [2]float64{intervals[0][0], intervals[len(intervals)-1][1]}, time.Since(start))
+		return "", calcErrs, ErrDownloadTimeout
+	} else if err != nil {
+		w.logJob("warn", "download failed", c, [2]float64{intervals[0][0], intervals[len(intervals)-1][1]}, time.Since(start), "err", err)
+		return "", calcErrs, ErrDownloadedFile
 	}
-	if nuEFlag >= 0 {
-		viper.Set("HITRAN.endNu", nuEFlag)
-	}
-	if ppmFlag >= 0 {
-		viper.Set("HITRAN.ppm", ppmFlag)
+	crawlProgress.Load().downloaded(time.Since(start))
+	return downloadedFileName, calcErrs, nil
+}
+
+// waitForDownload waits output.timeout_s for downloadName to be written.
+// Browsers create downloadName before its data lands, so it is done once
+// the partial download of Firefox (.part) and Chrome (.crdownload) is gone
+// and its size is non-zero and unchanged since the previous poll.
+func waitForDownload(ctx context.Context, downloadName string) error {
+	defer downloadWaitSeconds.observeSince(time.Now())
+	timeout := time.Duration(viper.GetInt("output.timeout_s")) * time.Second
+	lastSize := int64(-1)
+	return poll(ctx, timeout, func() (bool, error) {
+		for _, partial := range []string{downloadName + ".part", downloadName + ".crdownload"} {
+			if _, err := os.Stat(partial); err == nil {
+				lastSize = -1
+				return false, nil
+			}
+		}
+		fi, err := os.Stat(downloadName)
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		done := fi.Size() > 0 && fi.Size() == lastSize
+		lastSize = fi.Size()
+		return done, nil
+	})
+}
+
+func checkConfig() error {
+	if err := setupLogging(); err != nil {
+		return err
 	}
+	log("[inf] start program")
+	applyOverrides()
 	// Config file information sanitizing
 	// timeouts and delays
 	downloadTimeout := viper.GetInt("output.timeout_s")
@@ -274,33 +675,41 @@ func checkConfig() error {
 		log("[inf] calc delay (spectraplot.calcDelay_s) set to 1 second")
 		viper.Set("spectraplot.calcDelay_s", 1)
 	}
-	// HITRAN
-	nuStart, nuEnd := viper.GetFloat64("HITRAN.startNu"), viper.GetFloat64("HITRAN.endNu")
-	lambdaStart, lambdaEnd := viper.GetFloat64("HITRAN.startLambda"), viper.GetFloat64("HITRAN.endLambda")
-	if nuStart == 0 && nuEnd == 0 {
-		nuStart, nuEnd = waveLtoNum(lambdaStart), waveLtoNum(lambdaEnd)
-		viper.Set("HITRAN.startNu", nuStart)
-		viper.Set("HITRAN.endNu", nuEnd)
+	if retries := viper.GetInt("spectraplot.retries"); retries < 0 {
+		log("[inf] spectraplot.retries set to 0")
+		viper.Set("spectraplot.retries", 0)
 	}
-	if nuStart < 0 || nuStart > maxWaveNumber || nuEnd < 0 || nuEnd > maxWaveNumber {
-		return fmt.Errorf("exceeded spectral range [0-%f]. got vs=%f, ve=%f", maxWaveNumber, nuStart, nuEnd)
+	backoffBase, backoffCap := viper.GetFloat64("spectraplot.backoffBase_s"), viper.GetFloat64("spectraplot.backoffCap_s")
+	if backoffBase < 0 {
+		log("[inf] retry backoff (spectraplot.backoffBase_s) set to 5 seconds")
+		backoffBase = 5
+		viper.Set("spectraplot.backoffBase_s", backoffBase)
 	}
-	logf("[inf] scraping wavenumbers:[%.f-%.f]", nuStart, nuEnd)
-	if stepNu := viper.GetFloat64("HITRAN.stepNu"); stepNu < minNuStep {
-		viper.Set("HITRAN.stepNu", minNuStep)
-		logf("[inf] HITRAN.stepNu too low or not present. setting at %.2f", minNuStep)
+	if backoffCap < backoffBase {
+		logf("[inf] spectraplot.backoffCap_s set to %g seconds", backoffBase)
+		viper.Set("spectraplot.backoffCap_s", backoffBase)
 	}
-	T, p, L := viper.GetFloat64("HITRAN.T"), viper.GetFloat64("HITRAN.p"), viper.GetFloat64("HITRAN.L")
-	if T <= 0 || T > maxTemp || p <= 0 || L <= 0 {
-		return fmt.Errorf("temp to high or negative/zero value for pressure/temp/length.")
+	if rate := viper.GetFloat64("spectraplot.rateLimit_s"); rate < 0 {
+		log("[inf] spectraplot.rateLimit_s set to 0 seconds")
+		viper.Set("spectraplot.rateLimit_s", 0)
 	}
-
-	if ppm := viper.GetFloat64("HITRAN.ppm"); ppm <= 0 || ppm > 1e6 {
-		return fmt.Errorf("ppm <= 0 or greater than 1e6. got ppm = %f", ppm)
+	if workers := viper.GetInt("browser.workers"); workers < 1 {
+		viper.Set("browser.workers", 1)
 	}
-	format := viper.GetString("HITRAN.format")
-	if _, err := strconv.ParseFloat(fmt.Sprintf(format, T), 64); err != nil {
-		return fmt.Errorf("formatter '%s' invalid for float. %s", format, err.Error())
+	if err := checkAdaptiveConfig(); err != nil {
+		return err
+	}
+	if err := checkQuantity(outputQuantity()); err != nil {
+		return fmt.Errorf("output.quantity: %s", err)
+	}
+	sections := []string{configSection}
+	if allSections {
+		sections = configuredSections()
+	}
+	for _, section := range sections {
+		if err := inSection(section, checkSection); err != nil {
+			return err
+		}
 	}
 	// paths and files
 	// first sanitize paths
@@ -308,149 +717,282 @@ func checkConfig() error {
 	viper.Set("browser.driverPath", sanitizePath(viper.GetString("browser.driverPath")))
 	viper.Set("output.dir", sanitizePath(viper.GetString("output.dir")))
 	downloadDir := viper.GetString("browser.downloadDir")
-	_, err := os.Stat(downloadDir)
-	if os.IsNotExist(err) {
+	if browserType := viper.GetString("browser.type"); browserType != "" && browserType != browserChrome && browserType != browserFirefox {
+		return fmt.Errorf("unknown browser.type %q. expected %s or %s", browserType, browserChrome, browserFirefox)
+	}
+	if downloadDir == "" {
+		log("[inf] browser.downloadDir not set. downloading to a temporary directory")
+	} else if _, err := os.Stat(downloadDir); os.IsNotExist(err) {
 		return fmt.Errorf("directory does not exist. %s", err)
 	}
-	driverPath := viper.GetString("browser.driverPath")
-	_, err = os.Stat(driverPath)
-	if os.IsNotExist(err) {
+	if remoteURL := viper.GetString("browser.remoteURL"); remoteURL != "" {
+		logf("[inf] using remote WebDriver at %s", remoteURL)
+	} else if _, err := os.Stat(viper.GetString("browser.driverPath")); os.IsNotExist(err) {
 		return fmt.Errorf("driver does not exist in path given. %s", err)
 	}
-	gasID := viper.GetString("HITRAN.gasID")
-	if gasID == "" {
-		return fmt.Errorf("null HITRAN.gasID")
-	}
-	outputPath := viper.GetString("output.dir")
-	if outputPath == "auto" {
-		outputPath = fmt.Sprintf("."+fpsep+"output"+fpsep+"%s", gasID)
-	}
-	_, err = os.Stat(outputPath)
-	if os.IsNotExist(err) {
-		logf("[inf] creating output directory %s", outputPath)
-		err = os.MkdirAll(outputPath, os.ModePerm)
-		if err != nil {
+	for _, section := range sections {
+		if err := inSection(section, createOutputDirs); err != nil {
 			return err
 		}
 	}
 	viper.Set("browser.downloadDir", downloadDir)
-	viper.Set("output.dir", outputPath)
 	return nil
 }
 
-func setHitran(s *wd.Session, conditions spectraConditions) error {
-	Telem, err := query(s, `#hitran > div > div > table > tbody > tr:nth-child(1) > td:nth-child(2) > input[type=text]`)
-	if err != nil {
-		return ErrPageScan
+// checkSection sanitizes the wavenumber span, species and conditions of configSection.
+func checkSection() error {
+	nuStart, nuEnd := configNuSpan()
+	viper.Set(sectionKey("startNu"), nuStart)
+	viper.Set(sectionKey("endNu"), nuEnd)
+	if nuStart < 0 || nuStart > maxWaveNumber || nuEnd < 0 || nuEnd > maxWaveNumber {
+		return fmt.Errorf("exceeded spectral range [0-%f]. got vs=%f, ve=%f", maxWaveNumber, nuStart, nuEnd)
 	}
-	Pelem, err := query(s, `#hitran > div > div > table > tbody > tr:nth-child(2) > td:nth-child(2) > input[type=text]`)
-	if err != nil {
-		return err
+	logf("[inf] scraping wavenumbers:[%.f-%.f]", nuStart, nuEnd)
+	if stepNu := viper.GetFloat64(sectionKey("stepNu")); stepNu < minNuStep {
+		viper.Set(sectionKey("stepNu"), minNuStep)
+		logf("[inf] HITRAN.stepNu too low or not present. setting at %.2f", minNuStep)
 	}
-	Lelem, err := query(s, `#hitran > div > div > table > tbody > tr:nth-child(3) > td:nth-child(2) > input[type=text]`)
+	gases, err := gasIDs()
 	if err != nil {
 		return err
 	}
-	nuStartelem, err := query(s, `#hitran > div > div > table > tbody > tr:nth-child(1) > td:nth-child(5) > input[type=text]`)
-	if err != nil {
-		return err
+	for _, gas := range gases {
+		if stepNu := gasFloat(gas, "stepNu", minNuStep); stepNu < minNuStep {
+			return fmt.Errorf("%s.stepNu below minimum %.2f. got %g", sectionKey("perGas."+gas), minNuStep, stepNu)
+		}
+		if maxRange := gasMaxRange(gas); maxRange <= 0 {
+			return fmt.Errorf("maxRange must be positive for %s. got %g", gas, maxRange)
+		}
 	}
-	nuEndelem, err := query(s, `#hitran > div > div > table > tbody > tr:nth-child(2) > td:nth-child(5) > input[type=text]`)
+	jobs, err := crawlJobs()
 	if err != nil {
 		return err
 	}
-	nuStepelem, err := query(s, `#hitran > div > div > table > tbody > tr:nth-child(3) > td:nth-child(5) > input[type=text]`)
-	if err != nil {
-		return err
+	for _, c := range jobs {
+		if c.T <= 0 || c.T > maxTemp || c.P <= 0 || c.L <= 0 {
+			return fmt.Errorf("temp to high or negative/zero value for pressure/temp/length. got %s", conditionString(c))
+		}
+		if c.database == dbNIST && (c.Telec <= 0 || c.Telec > maxTemp) {
+			return fmt.Errorf("electronic temperature too high or negative/zero. got %s", conditionString(c))
+		}
+		var total float64
+		for _, s := range c.slots() {
+			if s.Ppm <= 0 || s.Ppm > 1e6 {
+				return fmt.Errorf("ppm <= 0 or greater than 1e6. got ppm = %f for %s", s.Ppm, s.species())
+			}
+			total += s.Ppm
+		}
+		if total > 1e6 {
+			return fmt.Errorf("mole fractions of %s add up to more than 1", c.gasID)
+		}
+		if len(c.mixture) > 0 && outputQuantity() == quantityCrossSection {
+			return fmt.Errorf("output.quantity %s undefined for mixture %s", quantityCrossSection, c.gasID)
+		}
+	}
+	if len(jobs) > 1 {
+		logf("[inf] sweeping %d combinations of gas, T, p, L and ppm", len(jobs))
 	}
-	//lamStartelem, err := query(s, `#hitran > div > div > table > tbody > tr:nth-child(1) > td:nth-child(3) > input[type=text]`)
-	//if err != nil {
-	//	return err
-	//}
-	//lamEndelem, err := query(s, `#hitran > div > div > table > tbody > tr:nth-child(2) > td:nth-child(3) > input[type=text]`)
-	//if err != nil {
-	//	return err
-	//}
-	Ppmelem, err := query(s, `#hitran > div > div > table > tbody > tr:nth-child(1) > td:nth-child(7) > input[type=text]`)
+	format := viper.GetString(sectionKey("format"))
+	if _, err := strconv.ParseFloat(fmt.Sprintf(format, jobs[0].T), 64); err != nil {
+		return fmt.Errorf("formatter '%s' invalid for float. %s", format, err.Error())
+	}
+	return nil
+}
+
+// createOutputDirs creates the output directories of the configSection gases.
+func createOutputDirs() error {
+	gases, err := gasIDs()
 	if err != nil {
 		return err
 	}
+	for _, gas := range gases {
+		outputPath := outputDirFor(gas)
+		_, err = os.Stat(outputPath)
+		if os.IsNotExist(err) {
+			logf("[inf] creating output directory %s", outputPath)
+			err = os.MkdirAll(outputPath, os.ModePerm)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyOverrides sets config values given by command line flags.
+func applyOverrides() {
+	if gasFlag != "" {
+		viper.Set(sectionKey("gasID"), gasFlag)
+	}
+	if nuSFlag >= 0 {
+		viper.Set(sectionKey("startNu"), nuSFlag)
+	}
+	if nuEFlag >= 0 {
+		viper.Set(sectionKey("endNu"), nuEFlag)
+	}
+	if ppmFlag >= 0 {
+		viper.Set(sectionKey("ppm"), ppmFlag)
+	}
+}
+
+// configNuSpan returns the configured wavenumber span. Wavelengths
+// are used if both wavenumbers are null.
+func configNuSpan() (nuStart, nuEnd float64) {
+	nuStart, nuEnd = viper.GetFloat64(sectionKey("startNu")), viper.GetFloat64(sectionKey("endNu"))
+	if nuStart == 0 && nuEnd == 0 {
+		lambdaStart, lambdaEnd := viper.GetFloat64(sectionKey("startLambda")), viper.GetFloat64(sectionKey("endLambda"))
+		nuStart, nuEnd = waveLtoNum(lambdaStart), waveLtoNum(lambdaEnd)
+	}
+	return nuStart, nuEnd
+}
+
+// outputBaseDir returns output.dir, or ./output if set to auto.
+func outputBaseDir() string {
+	outputPath := sanitizePath(viper.GetString("output.dir"))
+	if outputPath == "auto" {
+		outputPath = "." + fpsep + "output"
+	}
+	return outputPath
+}
+
+// outputDirFor returns the directory output files of species, i.e. CH4 or
+// CO2@HITEMP, are written to. This is output.dir when crawling a single gas
+// and output.dir/<species> when crawling several. output.dir set to auto
+// always yields ./output/<species>.
+func outputDirFor(species string) string {
+	if viper.GetString("output.dir") != "auto" {
+		if gases, _ := gasIDs(); len(gases) <= 1 {
+			return outputBaseDir()
+		}
+	}
+	return outputBaseDir() + fpsep + species
+}
+
+// setHitran fills the HITRAN tab form with conditions.
+func setHitran(s browserSession, conditions spectraConditions) error {
+	if err := leftClickSelector(s, selector("hitranTab")); err != nil {
+		return ErrPageScan
+	}
 	var format string
-	if format = viper.GetString("HITRAN.format"); format == "" {
+	if format = viper.GetString(sectionKey("format")); format == "" {
 		format = "%.3f"
 	}
-	Telem.Clear()
-	err = Telem.SendKeys(fmt.Sprintf(format, conditions.T))
-	if err != nil {
-		return err
+	fields := []formField{
+		{selector("hitranT"), format, conditions.T},
+		{selector("hitranP"), format, conditions.P},
+		{selector("hitranL"), format, conditions.L},
+		{selector("hitranNuEnd"), format, conditions.NuEnd},
+		{selector("hitranNuStart"), format, conditions.NuStart},
+		{selector("hitranNuStep"), "%0.3f", conditions.NuStep},
 	}
-	Pelem.Clear()
-	Pelem.SendKeys(fmt.Sprintf(format, conditions.P))
-	Lelem.Clear()
-	Lelem.SendKeys(fmt.Sprintf(format, conditions.L))
-	nuEndelem.Clear()
-	nuEndelem.SendKeys(fmt.Sprintf(format, conditions.NuEnd))
-	nuStartelem.Clear()
-	nuStartelem.SendKeys(fmt.Sprintf(format, conditions.NuStart))
-	nuStepelem.Clear()
-	nuStepelem.SendKeys(fmt.Sprintf("%0.3f", conditions.NuStep))
-	Ppmelem.Clear()
-	Ppmelem.SendKeys(fmt.Sprintf(strings.Replace(format, "f", "e", 1), conditions.Ppm*1e-6))
-	gasButton, _ := s.FindElement("xpath", `//*[@id="multicol-menu"]`)
-	gasButton.Click()
-	gasColumnElem, err := s.FindElements("xpath", `//*[@id="multicol-menu"]/li/ul/li/div[1]/ul`)
+	// slots left without species are zeroed so a previous mixture does not linger.
+	slots := conditions.slots()
+	for i := 0; i < mixtureSlots; i++ {
+		var ppm float64
+		if i < len(slots) {
+			ppm = slots[i].Ppm
+		}
+		fields = append(fields, formField{selector("hitranX", i+1), strings.Replace(format, "f", "e", 1), ppm * 1e-6})
+	}
+	return fillForm(s, fields)
+}
+
+// selectSpecies clicks gasID in the species menu of the given slot (1-3)
+// and checks the slot label shows it. HITEMP entries are told apart from
+// HITRAN ones by their hidden database span.
+func selectSpecies(s browserSession, slot int, gasID, database string) error {
+	if err := leftClickSelector(s, selector("hitranSpeciesMenu", slot)); err != nil {
+		return ErrPageScan
+	}
+	gasElem, err := s.FindElements("css selector", selector("hitranSpecies", slot))
 	if err != nil {
 		return err
 	}
-	for _, v := range gasColumnElem {
-		gasElem, err := v.FindElements("xpath", `li/a`)
-		if err != nil {
-			return err
+	for _, e := range gasElem {
+		gasName, _ := e.Text()
+		if name, _ := parseSpecies(gasName); name != gasID {
+			continue
 		}
-		for _, e := range gasElem {
-			gasName, _ := e.Text()
-			if gasName == viper.GetString("HITRAN.gasID") {
-				e.Click()
-			}
+		dbElem, _ := e.FindElements("css selector", selector("hitempMarker"))
+		if (len(dbElem) > 0) != (database == dbHITEMP) {
+			continue
 		}
+		if err = e.Click(); err != nil {
+			return err
+		}
+		return checkSpeciesLabel(s, selector("hitranSpeciesLabel", slot), gasID, database)
 	}
-	return nil
+	return fmt.Errorf("species %s not in species menu of slot %d", spectraConditions{gasID: gasID, database: database}.species(), slot)
 }
 
 func waveLtoNum(λ float64) float64  { return 1e4 / λ }
 func waveNumtoL(nu float64) float64 { return 1e4 / nu }
 
-func waitForCalculation(s *wd.Session) error {
-	loaded := false
-	timeout := false
-	go func() {
-		time.Sleep(time.Duration(viper.GetInt("spectraplot.calcTimeout_s")) * time.Second)
-		timeout = true
-	}()
-	submitButton, _ := s.FindElement("css selector", `#calculate_hitran`)
-	alertDangerButtons, _ := s.FindElements("css selector", `body > div[class='alert alert-danger alert-dismissible']`)
-	for !loaded {
+// waitForCalculation waits for the calculate button selected by button
+// to stop showing "Calculating...". Alerts shown meanwhile are returned as
+// an *AlertError if they fail the calculation and logged otherwise.
+func waitForCalculation(ctx context.Context, s browserSession, button string) error {
+	defer calcWaitSeconds.observeSince(time.Now())
+	submitButton, err := s.FindElement("css selector", button)
+	if err != nil {
+		return ErrPageScan
+	}
+	timeout := time.Duration(viper.GetInt("spectraplot.calcTimeout_s")) * time.Second
+	warnings := make(map[string]*AlertError)
+	err = poll(ctx, timeout, func() (bool, error) {
 		text, _ := submitButton.Text()
-		if text != "Calculating..." {
-			loaded = true
-		} else {
-			time.Sleep(time.Millisecond * 100)
+		// alerts are looked up anew as the page may add them on calculating.
+		for _, alert := range shownAlerts(s) {
+			if alert.fails() {
+				return false, alert
+			}
+			warnings[alert.ID] = alert
 		}
-		if timeout {
-			return ErrTimeout
+		return !calculating(text), nil
+	})
+	for _, alert := range warnings {
+		logf("[warn] %s", alert)
+	}
+	return err
+}
+
+// shownAlerts returns the alert divs of the page currently displayed and
+// closes them. spectraplot keeps alerts displayed until their close button
+// is clicked, which would otherwise fail every later calculation.
+func shownAlerts(s browserSession) (alerts []*AlertError) {
+	elems, _ := s.FindElements("css selector", selector("alerts"))
+	for _, e := range elems {
+		if stl, _ := e.GetAttribute("style"); !alertShown(stl) {
+			continue
 		}
-		for _, e := range alertDangerButtons {
-			stl, _ := e.GetAttribute("style")
-			if stl == "display: block;" {
-				return ErrDanger
-			}
+		id, _ := e.GetAttribute("id")
+		class, _ := e.GetAttribute("class")
+		text, _ := e.Text()
+		alerts = append(alerts, newAlertError(id, alertText(text), strings.Contains(class, "alert-danger")))
+		if buttons, _ := e.FindElements("css selector", selector("alertClose")); len(buttons) == 0 {
+			logf("[warn] no close button on %s alert", id)
+		} else if err := buttons[0].Click(); err != nil {
+			logf("[warn] closing %s alert. %s", id, err)
 		}
 	}
-	return nil
+	return alerts
 }
 
-func nuIntervals(nuStart, nuEnd float64) (intervals [][2]float64) {
-	maxRange := viper.GetFloat64("spectraplot.maxRange")
+// calculating reports whether the text of a calculate button shows a
+// calculation running. Firefox may trim the text differently than Chrome
+// and render the trailing dots as an ellipsis.
+func calculating(text string) bool {
+	return strings.HasPrefix(strings.TrimSpace(text), "Calculating")
+}
+
+// alertShown reports whether the style attribute of an alert div displays
+// it. Chrome reports "display: block;" while Firefox may drop the spacing.
+func alertShown(style string) bool {
+	return strings.Contains(strings.ReplaceAll(style, " ", ""), "display:block")
+}
+
+// nuIntervals splits nuStart-nuEnd into intervals at most maxRange wide.
+func nuIntervals(nuStart, nuEnd, maxRange float64) (intervals [][2]float64) {
 	if nuStart > nuEnd {
 		nuStart, nuEnd = nuEnd, nuStart
 	}
@@ -464,6 +1006,21 @@ func nuIntervals(nuStart, nuEnd float64) (intervals [][2]float64) {
 	return intervals
 }
 
+// batchIntervals groups contiguous intervals into batches of at most n intervals.
+func batchIntervals(intervals [][2]float64, n int) (batches [][][2]float64) {
+	if n < 1 {
+		n = 1
+	}
+	start := 0
+	for i := 1; i <= len(intervals); i++ {
+		if i == len(intervals) || i-start == n || intervals[i][0] != intervals[i-1][1] {
+			batches = append(batches, intervals[start:i])
+			start = i
+		}
+	}
+	return batches
+}
+
 func sanitizePath(path string) string {
 	fpsep := string(filepath.Separator)
 	path = strings.ReplaceAll(strings.ReplaceAll(path, "\\", fpsep), "/", fpsep)
@@ -473,11 +1030,17 @@ func sanitizePath(path string) string {
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// It is the only place spectracrawl exits with an error so that deferred
+// cleanup of commands always runs.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	if err == nil {
+		return
+	}
+	if _, logged := err.(loggedError); !logged {
 		fmt.Println(err)
-		os.Exit(1)
 	}
+	os.Exit(1)
 }
 
 var gasFlag string
@@ -485,8 +1048,10 @@ var ppmFlag, nuSFlag, nuEFlag float64
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.SilenceErrors = true // printed by Execute.
+	viper.SetDefault("spectraplot.url", urlStart)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", ".spectracrawl.yml", "config file (default is $HOME/.spectracrawl.yaml)")
-	rootCmd.PersistentFlags().StringVar(&gasFlag, "gas", "", "HITRAN.gasID override")
+	rootCmd.PersistentFlags().StringVar(&gasFlag, "gas", "", "HITRAN.gasID override. comma separated list crawls several gases")
 	rootCmd.PersistentFlags().Float64Var(&ppmFlag, "ppm", -1, "HITRAN.ppm override")
 	rootCmd.PersistentFlags().Float64Var(&nuSFlag, "nu1", -1, "HITRAN.startNu override")
 	rootCmd.PersistentFlags().Float64Var(&nuEFlag, "nu2", -1, "HITRAN.endNu override")
@@ -501,8 +1066,8 @@ func initConfig() {
 		// Find home directory.
 		home, err := homedir.Dir()
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			cfgErr = err
+			return
 		}
 
 		// Search config in home directory with name ".spectracrawl" (without extension).
@@ -517,24 +1082,3 @@ func initConfig() {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
 }
-
-func log(args ...interface{}) {
-	logf("%s", args...)
-}
-
-func logf(format string, args ...interface{}) {
-	var msg string
-	if len(args) == 0 {
-		msg = fmt.Sprintf(format)
-	} else {
-		msg = fmt.Sprintf(format, args...)
-	}
-	msg = strings.TrimSuffix(msg, "\n") + "\n"
-	if !viper.GetBool("log.silent") {
-		fmt.Print(msg)
-	}
-	if viper.GetBool("log.toFile") {
-		_, _ = logFile.WriteString(msg)
-		_ = logFile.Sync()
-	}
-}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultSelectors are the CSS selectors of every page element spectracrawl
+// drives. Each can be overridden with selectors.<name> in the config file.
+// Selectors taking a species slot hold a %d verb, nistIon also takes the
+// ionization state button id.
+var defaultSelectors = map[string]string{
+	"hitranTab":          `a[href="#hitran"]`,
+	"hitranT":            `#hitran input[name=T_hitran]`,
+	"hitranP":            `#hitran input[name=P_hitran]`,
+	"hitranL":            `#hitran input[name=L_hitran]`,
+	"hitranNuStart":      `#hitran input[name=vstart_hitran]`,
+	"hitranNuEnd":        `#hitran input[name=vend_hitran]`,
+	"hitranNuStep":       `#hitran input[name=deltav_hitran]`,
+	"hitranX":            `#hitran input[name=xspecies%d_hitran]`,
+	"hitranSpeciesMenu":  `#spec%d_hitran`,
+	"hitranSpecies":      `#spec%d_hitran + ul a.hitran_species`,
+	"hitranSpeciesLabel": `#specspan%d_hitran`,
+	"hitempMarker":       `span.db`,
+	"hitranCalculate":    `#calculate_hitran`,
+	"nistTab":            `a[href="#nist"]`,
+	"nistTelec":          `#nist input[name=Telec_nist]`,
+	"nistT":              `#nist input[name=T_nist]`,
+	"nistP":              `#nist input[name=P_nist]`,
+	"nistL":              `#nist input[name=L_nist]`,
+	"nistNuStart":        `#nist input[name=vstart_nist]`,
+	"nistNuEnd":          `#nist input[name=vend_nist]`,
+	"nistNuStep":         `#nist input[name=deltav_nist]`,
+	"nistX":              `#nist input[name=xspecies%d_nist]`,
+	"nistSpeciesMenu":    `#spec%d_nist`,
+	"nistIon":            `#spec%d_nist + ul #%s`,
+	"nistSpecies":        `#spec%d_nist + ul a.nist_species`,
+	"nistSpeciesLabel":   `#specspan%d_nist`,
+	"nistCalculate":      `#calculate_nist`,
+	"clear":              `#clear`,
+	"data":               `#data`,
+	"exportData":         `#exportform textarea[name=data]`,
+	"exportConditions":   `#exportform textarea[name=conditions]`,
+	"alerts":             `body > div.alert`,
+	"alertClose":         `button.close`,
+}
+
+// selector returns the CSS selector of the named page element formatted
+// with args, i.e. selector("hitranX", 2) for the second mole fraction input.
+func selector(name string, args ...interface{}) string {
+	sel := viper.GetString("selectors." + name)
+	if sel == "" {
+		sel = defaultSelectors[name]
+	}
+	if len(args) > 0 {
+		sel = fmt.Sprintf(sel, args...)
+	}
+	return sel
+}
+
+// selectorCheck is a page element required for crawling and the number
+// of elements its selector matched.
+type selectorCheck struct {
+	name, selector string
+	found          int
+}
+
+// requiredSelectors returns every element the page needs to crawl the
+// configured sections. Tabs of sections not configured are left out.
+func requiredSelectors() (checks []selectorCheck) {
+	add := func(name string, args ...interface{}) {
+		label := name
+		if len(args) > 0 {
+			label = fmt.Sprintf("%s%v", name, args)
+		}
+		checks = append(checks, selectorCheck{name: label, selector: selector(name, args...)})
+	}
+	for _, name := range []string{"clear", "data", "exportData", "exportConditions", "alerts"} {
+		add(name)
+	}
+	checks = append(checks, selectorCheck{name: "alertClose",
+		selector: selector("alerts") + " " + selector("alertClose")})
+	for _, section := range configuredSections() {
+		switch section {
+		case hitranSection:
+			for _, name := range []string{"hitranTab", "hitranT", "hitranP", "hitranL", "hitranNuStart",
+				"hitranNuEnd", "hitranNuStep", "hitranCalculate"} {
+				add(name)
+			}
+			for slot := 1; slot <= mixtureSlots; slot++ {
+				add("hitranX", slot)
+				add("hitranSpeciesMenu", slot)
+				add("hitranSpecies", slot)
+				add("hitranSpeciesLabel", slot)
+			}
+			checks = append(checks, selectorCheck{name: "hitempMarker",
+				selector: selector("hitranSpecies", 1) + " " + selector("hitempMarker")})
+		case nistSection:
+			for _, name := range []string{"nistTab", "nistTelec", "nistT", "nistP", "nistL",
+				"nistNuStart", "nistNuEnd", "nistNuStep", "nistCalculate"} {
+				add(name)
+			}
+			add("nistX", 1)
+			add("nistSpeciesMenu", 1)
+			add("nistSpecies", 1)
+			add("nistSpeciesLabel", 1)
+			for _, ion := range nistIonStates {
+				add("nistIon", 1, ion.button)
+			}
+		}
+	}
+	return checks
+}
+
+// checkSelectors counts the elements matched by each required selector
+// with find and returns the checks along with the number of missing elements.
+func checkSelectors(find func(selector string) int) (checks []selectorCheck, missing int) {
+	checks = requiredSelectors()
+	for i := range checks {
+		checks[i].found = find(checks[i].selector)
+		if checks[i].found == 0 {
+			missing++
+		}
+	}
+	return checks, missing
+}
+
+func printSelectorChecks(w io.Writer, checks []selectorCheck) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range checks {
+		status := "ok"
+		if c.found == 0 {
+			status = "MISSING"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", status, c.name, c.selector)
+	}
+	_ = tw.Flush()
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks spectraplot.url has every page element spectracrawl needs",
+	Long: `Checks spectraplot.url has every page element spectracrawl needs
+
+Loads the page in a browser session and looks up every selector of the
+HITRAN and NIST tabs configured with a gasID or mixture. Run it before a long crawl so a site redesign fails
+in seconds. Selectors can be overridden with selectors.<name> in the config.
+`,
+	Args: configArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := newWebDriver(0)
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+		checks, missing := checkSelectors(func(selector string) int {
+			elems, _ := d.s.FindElements("css selector", selector)
+			return len(elems)
+		})
+		printSelectorChecks(os.Stdout, checks)
+		if missing > 0 {
+			return fmt.Errorf("%d of %d page elements missing in %s", missing, len(checks), viper.GetString("spectraplot.url"))
+		}
+		logf("[inf] all %d page elements found in %s", len(checks), viper.GetString("spectraplot.url"))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
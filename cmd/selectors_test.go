@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSelectorOverride(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	if sel := selector("hitranX", 2); sel != `#hitran input[name=xspecies2_hitran]` {
+		t.Errorf("unexpected default selector %s", sel)
+	}
+	viper.Set("selectors.hitranT", `input#temperature`)
+	if sel := selector("hitranT"); sel != `input#temperature` {
+		t.Errorf("expected overridden selector, got %s", sel)
+	}
+}
+
+func TestCheckSelectors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("selectors.nistTab", `a[href="#atoms"]`)
+	find := func(selector string) int {
+		if strings.Contains(selector, "#atoms") {
+			return 0
+		}
+		return 1
+	}
+	viper.Set("HITRAN.gasID", "CH4")
+	if _, missing := checkSelectors(find); missing != 0 {
+		t.Errorf("expected NIST tab left out of HITRAN only crawls, got %d missing", missing)
+	}
+	viper.Set("NIST.gasID", "Na")
+	checks, missing := checkSelectors(find)
+	if missing != 1 {
+		t.Errorf("expected 1 missing element, got %d", missing)
+	}
+	for _, c := range checks {
+		if c.name == "nistTab" && c.found != 0 {
+			t.Errorf("expected nistTab missing, got %+v", c)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// Line databases offered in spectraplot's species menu. HITRAN is the
+// default and is stored as an empty database in spectraConditions.
+const (
+	dbHITRAN = "HITRAN"
+	dbHITEMP = "HITEMP"
+	// dbNIST holds atomic lines, crawled with the nist command.
+	dbNIST = "NIST"
+)
+
+// hitempSpecies are the gases listed under HITEMP 2010 in the species menu.
+var hitempSpecies = []string{"CO", "CO2", "H2O", "NO", "OH"}
+
+// nistIonStates are the ionization state suffixes of NIST species and the
+// id of the button selecting them, i.e. K+ is singly ionized potassium.
+var nistIonStates = []struct{ suffix, button string }{
+	{"2+", "plus2"},
+	{"+", "plus1"},
+	{"", "ground"},
+}
+
+// nistAtom splits a NIST species such as Ca2+ into atom (Ca) and ionization
+// state button id (plus2). ok is false if gasID is not an atom symbol
+// followed by an ionization state.
+func nistAtom(gasID string) (atom, ionButton string, ok bool) {
+	for _, ion := range nistIonStates {
+		if !strings.HasSuffix(gasID, ion.suffix) {
+			continue
+		}
+		atom = strings.TrimSuffix(gasID, ion.suffix)
+		ok = len(atom) >= 1 && len(atom) <= 2 && unicode.IsUpper(rune(atom[0])) &&
+			(len(atom) == 1 || unicode.IsLower(rune(atom[1])))
+		return atom, ion.button, ok
+	}
+	return gasID, "", false
+}
+
+// parseSpecies splits a species as written in config and filenames
+// (CO2@HITEMP) or as labeled by spectraplot (CO2 HITEMP) into gas ID
+// and database. The database is empty for HITRAN.
+func parseSpecies(species string) (gasID, database string) {
+	species = strings.TrimSpace(species)
+	if strings.Contains(species, mixtureSep) {
+		return species, "" // mixture name
+	}
+	i := strings.LastIndexAny(species, "@ ")
+	if i < 0 {
+		return species, ""
+	}
+	gasID, database = strings.TrimSpace(species[:i]), strings.ToUpper(species[i+1:])
+	if database == dbHITRAN {
+		database = ""
+	}
+	return gasID, database
+}
+
+// species returns the gas ID of c followed by @<database> if not HITRAN,
+// i.e. CO2@HITEMP. It names output directories and per gas overrides.
+func (c spectraConditions) species() string {
+	if c.database == "" {
+		return c.gasID
+	}
+	return c.gasID + "@" + c.database
+}
+
+// checkSpecies returns an error if gasID is not listed for database or if
+// database is not crawled from configSection.
+func checkSpecies(gasID, database string) error {
+	if (database == dbNIST) != (configSection == nistSection) {
+		return fmt.Errorf("%s species are crawled with the nist command and only there. got %s@%s", dbNIST, gasID, database)
+	}
+	switch database {
+	case "":
+		return nil
+	case dbNIST:
+		if _, _, ok := nistAtom(gasID); !ok {
+			return fmt.Errorf("%s is not an atom with ionization state, i.e. Na, K+ or Ca2+", gasID)
+		}
+		return nil
+	case dbHITEMP:
+		for _, gas := range hitempSpecies {
+			if gas == gasID {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s not in HITEMP. HITEMP species are %s", gasID, strings.Join(hitempSpecies, ", "))
+	}
+	return fmt.Errorf("unknown database %q for %s. expected HITRAN, HITEMP or NIST", database, gasID)
+}
+
+// defaultDatabase returns HITRAN.database, the database of gases given
+// without @<database>. It is always NIST in the NIST section.
+func defaultDatabase() string {
+	if configSection == nistSection {
+		return dbNIST
+	}
+	db := strings.ToUpper(strings.TrimSpace(viper.GetString(sectionKey("database"))))
+	if db == dbHITRAN {
+		return ""
+	}
+	return db
+}
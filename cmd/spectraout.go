@@ -3,9 +3,11 @@ package cmd
 import (
 	"archive/zip"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -27,14 +29,185 @@ func (a byNuMin) Len() int           { return len(a) }
 func (a byNuMin) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a byNuMin) Less(i, j int) bool { return a[i].nuMin < a[j].nuMin }
 
-func processSpectra(zipName, outputDir string) error {
+// conditionTolerance is the relative difference allowed between requested
+// conditions and the conditions in the header of downloaded spectra.
+const conditionTolerance = 1e-3
+
+// processSpectra merges the spectra in zipName into a single CSV file in
+// outputDir and returns the name of the merged file. The spectra must hold
+// conditions want and span intervals, one spectrum per interval.
+func processSpectra(zipName, outputDir string, want spectraConditions, intervals [][2]float64) (string, error) {
 	_, err := os.Stat(outputDir)
 	if os.IsNotExist(err) {
+		return "", err
+	}
+	allRecords, conditions, err := readSpectraZip(zipName)
+	if err != nil {
+		return "", err
+	}
+	if err = checkSpectra(allRecords, conditions, want, intervals); err != nil {
+		return "", err
+	}
+	minWN, maxWN := allRecords[0].nuMin, allRecords[len(allRecords)-1].nuMax
+	spectraCond, err := parseSpectraConditions(conditions)
+	if err != nil {
+		return "", err
+	}
+	// The header may leave out the database and Te.
+	spectraCond.database = want.database
+	if spectraCond.Telec == 0 {
+		spectraCond.Telec = want.Telec
+	}
+	outputName := generateFilename(spectraCond, [2]float64{minWN, maxWN}) // fmt.Sprintf("nu=%.f-%.f%s%s.csv", minWN, maxWN, sep, strings.Join(conditions, sep))
+	quantity := outputQuantity()
+	err = writeCSVFile(outputDir+fpsep+outputName, func(w *csv.Writer) error {
+		err := w.Write(generateHeader(conditions, append(adaptiveMeta(intervals), quantityMeta(quantity)...)...))
+		if err != nil {
+			return err
+		}
+		for _, v := range allRecords {
+			for _, row := range v.data[1:] {
+				if row[1], err = convertValue(row[1], quantityAbsorbance, quantity, spectraCond); err != nil {
+					return fmt.Errorf("%s at nu=%s. %s", v.filename, row[0], err)
+				}
+			}
+			if err = w.WriteAll(v.data[1:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return outputName, nil
+}
+
+// writeCSVFile writes name with write through a temporary file in the same
+// directory, renamed to name once written, so that failures never leave a
+// truncated file behind to be taken for finished output.
+func writeCSVFile(name string, write func(w *csv.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(name), ".spectracrawl-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	w := csv.NewWriter(f)
+	if err = write(w); err != nil {
 		return err
 	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// processMixture merges the spectra of a mixture into a single CSV file in
+// outputDir and returns the name of the merged file. zipNames holds the
+// download of the mixture followed by the downloads of each of its species.
+// Columns follow the same order, all sharing the wavenumber column. want
+// holds the conditions of each download, which must span intervals.
+func processMixture(zipNames []string, outputDir string, want []spectraConditions, intervals [][2]float64) (string, error) {
+	_, err := os.Stat(outputDir)
+	if os.IsNotExist(err) {
+		return "", err
+	}
+	var columns [][]spectra
+	var columnCond []spectraConditions
+	header := []string{"nu"}
+	quantity := outputQuantity()
+	for i, zipName := range zipNames {
+		records, conditions, err := readSpectraZip(zipName)
+		if err != nil {
+			return "", err
+		}
+		if err = checkSpectra(records, conditions, want[i], intervals); err != nil {
+			return "", err
+		}
+		if len(columns) > 0 && len(records) != len(columns[0]) {
+			return "", fmt.Errorf("mixture species spectra do not match mixture spectra")
+		}
+		columns = append(columns, records)
+		columnCond = append(columnCond, want[i])
+		if i == 0 {
+			header = append(header, generateHeader(conditions, append(adaptiveMeta(intervals), quantityMeta(quantity)...)...)[1])
+		} else {
+			header = append(header, generateHeader(conditions)[1])
+		}
+	}
+	mix := columns[0]
+	minWN, maxWN := mix[0].nuMin, mix[len(mix)-1].nuMax
+	outputName := generateFilename(columnCond[0], [2]float64{minWN, maxWN})
+	err = writeCSVFile(outputDir+fpsep+outputName, func(w *csv.Writer) error {
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		for i := range mix {
+			for j, row := range mix[i].data[1:] {
+				record := []string{row[0]}
+				for k, column := range columns {
+					if len(column[i].data) != len(mix[i].data) || column[i].data[j+1][0] != row[0] {
+						return fmt.Errorf("wavenumbers of %s differ from mixture at nu=%s", column[i].filename, row[0])
+					}
+					v, err := convertValue(column[i].data[j+1][1], quantityAbsorbance, quantity, columnCond[k])
+					if err != nil {
+						return fmt.Errorf("%s at nu=%s. %s", column[i].filename, row[0], err)
+					}
+					record = append(record, v)
+				}
+				if err := w.Write(record); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return outputName, nil
+}
+
+// parseExportForm returns the plots held by spectraplot's export form. data
+// holds the plotted lines as JSON, i.e. {"line0": [{"abs": 0, "nu": 6200}]},
+// and conditions one condition string per line.
+func parseExportForm(data, conditions string) ([]plotLine, error) {
+	var points map[string][]struct{ Abs, Nu float64 }
+	if err := json.Unmarshal([]byte(data), &points); err != nil {
+		return nil, err
+	}
+	lineConditions := strings.Split(strings.TrimSpace(conditions), "\n")
+	var lines []plotLine
+	for i := 0; i < len(points); i++ {
+		line, ok := points[fmt.Sprintf("line%d", i)]
+		if !ok || i >= len(lineConditions) {
+			return nil, fmt.Errorf("plotted lines and conditions do not match")
+		}
+		plot := plotLine{Conditions: strings.TrimSpace(lineConditions[i])}
+		for _, p := range line {
+			plot.Nu = append(plot.Nu, p.Nu)
+			plot.Abs = append(plot.Abs, p.Abs)
+		}
+		lines = append(lines, plot)
+	}
+	return lines, nil
+}
+
+// readSpectraZip reads the spectra in zipName sorted by wavenumber along
+// with the conditions they share.
+func readSpectraZip(zipName string) ([]spectra, []string, error) {
 	r, err := zip.OpenReader(zipName)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	defer r.Close()
 	var allRecords []spectra
@@ -44,15 +217,15 @@ func processSpectra(zipName, outputDir string) error {
 		defer rc.Close()
 		records, err := csv.NewReader(rc).ReadAll()
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		wavenumMax, err := strconv.ParseFloat(records[len(records)-1][0], 64)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		wavenumMin, err := strconv.ParseFloat(records[1][0], 64)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		c := strings.Split(records[0][1], "/")
 		if conditions == nil {
@@ -60,7 +233,7 @@ func processSpectra(zipName, outputDir string) error {
 		}
 		for i, v := range conditions {
 			if c[i] != v {
-				return fmt.Errorf("gas absorption conditions differ")
+				return nil, nil, fmt.Errorf("gas absorption conditions differ")
 			}
 		}
 		allRecords = append(allRecords, spectra{
@@ -73,40 +246,141 @@ func processSpectra(zipName, outputDir string) error {
 		})
 	}
 	if len(allRecords) == 0 {
-		return fmt.Errorf("no files processed in zip")
+		return nil, nil, fmt.Errorf("no files processed in zip")
 	}
 	sort.Sort(byNuMin(allRecords))
-	minWN, maxWN := allRecords[0].nuMin, allRecords[len(allRecords)-1].nuMax
-	spectraCond, err := parseSpectraConditions(conditions)
-	if err != nil {
+	return allRecords, conditions, nil
+}
+
+// checkSpectra returns an error wrapping ErrConditionMismatch if the
+// conditions of records differ from want or if records do not span
+// intervals at want.NuStep.
+func checkSpectra(records []spectra, conditions []string, want spectraConditions, intervals [][2]float64) error {
+	got, err := parseSpectraConditions(conditions)
+	switch {
+	case len(want.mixture) > 0 && (err != nil || len(got.mixture) == 0):
+		// No mixture export has been checked for its label. Its species
+		// are downloaded and checked on their own.
+		logf("[warn] conditions of mixture label %q not checked", strings.Join(conditions, "/"))
+	case err != nil:
 		return err
+	default:
+		if err = checkConditions(got, want); err != nil {
+			return err
+		}
 	}
-	outputName := generateFilename(spectraCond, [2]float64{minWN, maxWN}) // fmt.Sprintf("nu=%.f-%.f%s%s.csv", minWN, maxWN, sep, strings.Join(conditions, sep))
-	f, err := os.Create(outputDir + fpsep + outputName)
-	if err != nil {
-		return err
+	if len(records) != len(intervals) {
+		return fmt.Errorf("%w: got %d spectra, requested %d intervals", ErrConditionMismatch, len(records), len(intervals))
 	}
-	defer f.Close()
-	w := csv.NewWriter(f)
-	err = w.Write(generateHeader(conditions))
-	if err != nil {
-		return err
+	// spectraplot may leave out the last point of an interval.
+	nuTol := want.NuStep * (1 + conditionTolerance)
+	for i, r := range records {
+		if !withinTolerance(r.nuMin, intervals[i][0], nuTol) || !withinTolerance(r.nuMax, intervals[i][1], nuTol) {
+			return fmt.Errorf("%w: got nu=[%g-%g], requested [%g-%g]", ErrConditionMismatch, r.nuMin, r.nuMax, intervals[i][0], intervals[i][1])
+		}
+		if r.N < 3 {
+			continue
+		}
+		nu0, err0 := strconv.ParseFloat(r.data[1][0], 64)
+		nu1, err1 := strconv.ParseFloat(r.data[2][0], 64)
+		if err0 != nil || err1 != nil {
+			return fmt.Errorf("bad wavenumber in %s", r.filename)
+		}
+		if !withinTolerance(nu1-nu0, want.NuStep, conditionTolerance*want.NuStep) {
+			return fmt.Errorf("%w: got nu step %g, requested %g", ErrConditionMismatch, nu1-nu0, want.NuStep)
+		}
 	}
-	for _, v := range allRecords {
-		err = w.WriteAll(v.data[1:])
-		if err != nil {
-			return err
+	return nil
+}
+
+// checkConditions returns an error wrapping ErrConditionMismatch if got
+// differs from want.
+func checkConditions(got, want spectraConditions) error {
+	gotSlots, wantSlots := got.slots(), want.slots()
+	if len(gotSlots) != len(wantSlots) {
+		return fmt.Errorf("%w: got %d species, requested %d", ErrConditionMismatch, len(gotSlots), len(wantSlots))
+	}
+	// Like species labels, headers may leave out the database.
+	for i := range wantSlots {
+		g, w := gotSlots[i], wantSlots[i]
+		if g.gasID != w.gasID || g.database != "" && g.database != w.database {
+			return fmt.Errorf("%w: got %s, requested %s", ErrConditionMismatch, got.species(), want.species())
+		}
+	}
+	values := []struct {
+		name      string
+		got, want float64
+	}{{"T", got.T, want.T}, {"P", got.P, want.P}, {"L", got.L, want.L}}
+	// Te is only checked when the header states it as no NIST export
+	// has been checked for its label.
+	if want.database == dbNIST && got.Telec != 0 {
+		values = append(values, struct {
+			name      string
+			got, want float64
+		}{"Te", got.Telec, want.Telec})
+	}
+	for i := range wantSlots {
+		values = append(values, struct {
+			name      string
+			got, want float64
+		}{"x of " + wantSlots[i].species(), gotSlots[i].Ppm * 1e-6, wantSlots[i].Ppm * 1e-6})
+	}
+	for _, v := range values {
+		if !withinTolerance(v.got, v.want, conditionTolerance*math.Abs(v.want)) {
+			return fmt.Errorf("%w: got %s=%g, requested %g", ErrConditionMismatch, v.name, v.got, v.want)
 		}
 	}
 	return nil
 }
 
-func generateHeader(conditions []string) (h []string) {
+func withinTolerance(got, want, tol float64) bool { return math.Abs(got-want) <= tol }
+
+// generateHeader returns the header of an output file, the wavenumber
+// column followed by the conditions of the spectrum and key-value metadata
+// meta, i.e. segments=1000-1100;1100-1200.
+func generateHeader(conditions []string, meta ...string) (h []string) {
 	h = append(h, "nu")
-	cond := strings.Join(conditions, "/")
+	cond := strings.Join(append(append([]string(nil), conditions...), meta...), "/")
 	return append(h, cond)
 }
 
+// segmentsMeta returns the segments metadata of an output file holding
+// intervals, each calculated on its own.
+func segmentsMeta(intervals [][2]float64) string {
+	segments := make([]string, len(intervals))
+	for i, interval := range intervals {
+		segments[i] = strconv.FormatFloat(interval[0], 'f', -1, 64) + "-" + strconv.FormatFloat(interval[1], 'f', -1, 64)
+	}
+	return "segments=" + strings.Join(segments, ";")
+}
+
+// conditionString formats conditions the way spectraplot labels a plot,
+// i.e. CH4/x=1e-6/T=300K/P=1atm/L=100cm, CO2 HITEMP/x=1e-6/T=300K/P=1atm/L=100cm,
+// Na NIST/Te=1000K/x=1e-7/T=300K/P=1atm/L=1cm or for mixtures
+// H2O_CO2/x=0.02_0.0004/T=300K/P=1atm/L=100cm. The Te field and mixture
+// labels are the mock server's, checkSpectra does not rely on spectraplot
+// exporting them.
+func conditionString(c spectraConditions) string {
+	gas := c.gasID
+	if c.database != "" {
+		gas += " " + c.database
+	}
+	if c.database == dbNIST {
+		gas += "/Te=" + jsFloat(c.Telec) + "K"
+	}
+	var x []string
+	for _, s := range c.slots() {
+		x = append(x, jsFloat(s.Ppm*1e-6))
+	}
+	return fmt.Sprintf("%s/x=%s/T=%sK/P=%satm/L=%scm", gas,
+		strings.Join(x, mixtureSep), jsFloat(c.T), jsFloat(c.P), jsFloat(c.L))
+}
+
+// jsFloat formats a float the way spectraplot's javascript would.
+func jsFloat(f float64) string {
+	return strings.Replace(strconv.FormatFloat(f, 'g', -1, 64), "e-0", "e-", 1)
+}
+
 func parseSpectraConditions(conditionSlice []string) (c spectraConditions, err error) {
 	var f float64
 	for _, val := range conditionSlice {
@@ -115,22 +389,32 @@ func parseSpectraConditions(conditionSlice []string) (c spectraConditions, err e
 			err = fmt.Errorf("expected spectra key-value in parseSpectraConditions")
 			return
 		} else if len(keyval) == 1 {
-			c.gasID = keyval[0]
+			c.gasID, c.database = parseSpecies(keyval[0])
+			c.mixture = parseMixtureName(c.gasID)
 			continue
 		}
 		switch keyval[0] {
 		case "x":
+			if len(c.mixture) > 0 {
+				err = parseMixtureFractions(c.mixture, keyval[1])
+				break
+			}
 			f, err = strconv.ParseFloat(keyval[1], 64)
 			c.Ppm = f * 1e6
 		case "T":
 			f, err = strconv.ParseFloat(strings.ReplaceAll(keyval[1], "K", ""), 64)
 			c.T = f
+		case "Te":
+			f, err = strconv.ParseFloat(strings.ReplaceAll(keyval[1], "K", ""), 64)
+			c.Telec = f
 		case "P":
 			f, err = strconv.ParseFloat(strings.ReplaceAll(keyval[1], "atm", ""), 64)
 			c.P = f
 		case "L":
 			f, err = strconv.ParseFloat(strings.ReplaceAll(keyval[1], "cm", ""), 64)
 			c.L = f
+		case "segments", "quantity", "unit":
+			// output metadata, not a condition.
 		default:
 			err = fmt.Errorf("unknown key value pair %s:%s", keyval[0], keyval[1])
 		}
@@ -141,12 +425,37 @@ func parseSpectraConditions(conditionSlice []string) (c spectraConditions, err e
 	return
 }
 
+// generateFilename returns the name of the output file of spectra with
+// conditions c spanning interval in output.quantity.
 func generateFilename(c spectraConditions, interval [2]float64) string {
 	var strcond []string
 	sep := ","
-	strcond = append(strcond, c.gasID,
-		"x="+prettyF(c.Ppm*1e-6), "T="+prettyF(c.T)+"K", "P="+prettyF(c.P)+"atm", "L="+prettyF(c.L)+"cm")
-	return fmt.Sprintf("nu=%.f-%.f%s%s.csv", interval[0], interval[1], sep, strings.Join(strcond, sep))
+	strcond = append(strcond, c.species())
+	if c.database == dbNIST {
+		strcond = append(strcond, "Te="+prettyF(c.Telec)+"K")
+	}
+	var x []string
+	for _, s := range c.slots() {
+		x = append(x, prettyF(s.Ppm*1e-6))
+	}
+	strcond = append(strcond,
+		"x="+strings.Join(x, mixtureSep), "T="+prettyF(c.T)+"K", "P="+prettyF(c.P)+"atm", "L="+prettyF(c.L)+"cm")
+	return quantityFilename(fmt.Sprintf("nu=%.f-%.f%s%s.csv", interval[0], interval[1], sep, strings.Join(strcond, sep)), outputQuantity())
+}
+
+// quantityFilename returns the output file name renamed for quantity.
+// Names of quantities other than absorbance end in their quantity, i.e.
+// nu=1000-1300,CH4,x=1e-06,T=300K,P=1atm,L=100cm,quantity=transmittance.csv
+// so that files of different quantities are never taken for each other.
+func quantityFilename(name, quantity string) string {
+	name = strings.TrimSuffix(name, ".csv")
+	if i := strings.Index(name, ",quantity="); i >= 0 {
+		name = name[:i]
+	}
+	if quantity != quantityAbsorbance {
+		name += ",quantity=" + quantity
+	}
+	return name + ".csv"
 }
 
 func prettyF(f float64) string {
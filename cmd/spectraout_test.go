@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"archive/zip"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -15,6 +17,36 @@ const (
 	numberOfJobs  = 3
 )
 
+func TestWriteCSVFile(t *testing.T) {
+	dir := t.TempDir()
+	name := dir + fpsep + "nu=1000-1100,CH4.csv"
+	errWrite := errors.New("conversion failed")
+	err := writeCSVFile(name, func(w *csv.Writer) error {
+		if err := w.Write([]string{"nu", "CH4"}); err != nil {
+			return err
+		}
+		return errWrite
+	})
+	if err != errWrite {
+		t.Fatalf("expected write error, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected no file left after failed write, got %s", entries[0].Name())
+	}
+	err = writeCSVFile(name, func(w *csv.Writer) error {
+		return w.WriteAll([][]string{{"nu", "CH4"}, {"1000", "0.5"}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(name); err != nil || string(b) != "nu,CH4\n1000,0.5\n" {
+		t.Errorf("unexpected file %q. %v", b, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only the written file in %s, got %d entries", dir, len(entries))
+	}
+}
+
 func TestPrettyFormat(t *testing.T) {
 	tests := map[float64]string{
 		0:          "0",
@@ -51,13 +83,61 @@ func TestJoinSpectra(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	err = processSpectra(zipname, testDataDir)
+	want := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, NuStep: 0.01, gasID: "CH4"}
+	_, err = processSpectra(zipname, testDataDir, want, [][2]float64{{6200, 6300}, {6300, 6400}, {6400, 6500}})
 	if err != nil {
 		t.Error(err)
 	}
 
 }
 
+func TestCheckSpectra(t *testing.T) {
+	want := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, NuStep: 0.5, gasID: "CH4"}
+	intervals := [][2]float64{{1000, 1010}, {1010, 1020}}
+	for name, test := range map[string]struct {
+		mangle func(c *spectraConditions)
+		match  bool
+	}{
+		"same":      {func(c *spectraConditions) {}, true},
+		"roundoff":  {func(c *spectraConditions) { c.T = 300.0001 }, true},
+		"T":         {func(c *spectraConditions) { c.T = 296 }, false},
+		"ppm":       {func(c *spectraConditions) { c.Ppm = 10 }, false},
+		"gas":       {func(c *spectraConditions) { c.gasID = "CO" }, false},
+		"database":  {func(c *spectraConditions) { c.gasID, c.database = "CO2", dbHITEMP }, false},
+		"step":      {func(c *spectraConditions) { c.NuStep = 0.25 }, false},
+		"span":      {func(c *spectraConditions) { c.NuEnd += 5 }, false},
+		"truncated": {func(c *spectraConditions) { c.NuEnd -= c.NuStep }, true},
+	} {
+		var lines []plotLine
+		for _, interval := range intervals {
+			c := want
+			c.NuStart, c.NuEnd = interval[0], interval[1]
+			test.mangle(&c)
+			lines = append(lines, syntheticSpectrum(c))
+		}
+		zipName := t.TempDir() + fpsep + defaultZipName
+		fo, err := os.Create(zipName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writeSpectraZip(fo, lines)
+		fo.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, conditions, err := readSpectraZip(zipName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = checkSpectra(records, conditions, want, intervals)
+		if test.match && err != nil {
+			t.Errorf("%s: expected spectra to match. %s", name, err)
+		} else if !test.match && !errors.Is(err, ErrConditionMismatch) {
+			t.Errorf("%s: expected ErrConditionMismatch, got %v", name, err)
+		}
+	}
+}
+
 func createSpectraZip() error {
 	fo, err := os.Create(zipname)
 	if err != nil {
@@ -103,3 +183,103 @@ func splitNameAndDir(filename string) (name, dir string) {
 	name, dir = filename[strings.LastIndex(filename, fpsep)+1:], filename[:strings.LastIndex(filename, fpsep)-1]
 	return
 }
+
+func TestCheckSpectraNIST(t *testing.T) {
+	want := spectraConditions{T: 300, P: 1, L: 1, Ppm: 0.1, Telec: 1000, NuStep: 0.01, gasID: "Na", database: dbNIST}
+	intervals := [][2]float64{{16900, 16901}}
+	for name, test := range map[string]struct {
+		Telec   float64
+		stripTe bool
+		match   bool
+	}{
+		"same":     {1000, false, true},
+		"Te":       {2000, false, false},
+		"Te unset": {2000, true, true},
+	} {
+		c := want
+		c.NuStart, c.NuEnd, c.Telec = intervals[0][0], intervals[0][1], test.Telec
+		line := syntheticSpectrum(c)
+		if test.stripTe {
+			line.Conditions = strings.Replace(line.Conditions, "/Te=2000K", "", 1)
+		}
+		records, conditions := readTestZip(t, []plotLine{line})
+		err := checkSpectra(records, conditions, want, intervals)
+		if test.match && err != nil {
+			t.Errorf("%s: expected spectra to match. %s", name, err)
+		} else if !test.match && !errors.Is(err, ErrConditionMismatch) {
+			t.Errorf("%s: expected ErrConditionMismatch, got %v", name, err)
+		}
+	}
+}
+
+func TestCheckSpectraMixture(t *testing.T) {
+	want := spectraConditions{T: 300, P: 1, L: 100, NuStep: 0.5, gasID: "H2O_CO2", mixture: []mixtureSpecies{
+		{gasID: "H2O", Ppm: 2e4}, {gasID: "CO2", Ppm: 400},
+	}}
+	intervals := [][2]float64{{1000, 1010}}
+	for name, test := range map[string]struct {
+		label  string
+		extend float64
+		match  bool
+	}{
+		"same":         {"H2O_CO2/x=0.02_0.0004/T=300K/P=1atm/L=100cm", 0, true},
+		"x":            {"H2O_CO2/x=0.02_0.004/T=300K/P=1atm/L=100cm", 0, false},
+		"unknown":      {"H2O+CO2/x=0.02+0.0004/T=300K/P=1atm/L=100cm", 0, true},
+		"unknown span": {"H2O+CO2/x=0.02+0.0004/T=300K/P=1atm/L=100cm", 5, false},
+	} {
+		c := want
+		c.NuStart, c.NuEnd = intervals[0][0], intervals[0][1]+test.extend
+		line := syntheticSpectrum(c)
+		line.Conditions = test.label
+		records, conditions := readTestZip(t, []plotLine{line})
+		err := checkSpectra(records, conditions, want, intervals)
+		if test.match && err != nil {
+			t.Errorf("%s: expected spectra to match. %s", name, err)
+		} else if !test.match && !errors.Is(err, ErrConditionMismatch) {
+			t.Errorf("%s: expected ErrConditionMismatch, got %v", name, err)
+		}
+	}
+}
+
+func TestCheckSpectraDatabase(t *testing.T) {
+	want := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, NuStep: 0.5, gasID: "CO2", database: dbHITEMP}
+	intervals := [][2]float64{{1000, 1010}}
+	for label, match := range map[string]bool{
+		"CO2 HITEMP/x=1e-6/T=300K/P=1atm/L=100cm": true,
+		"CO2/x=1e-6/T=300K/P=1atm/L=100cm":        true,
+		"CO2@NIST/x=1e-6/T=300K/P=1atm/L=100cm":   false,
+		"CO/x=1e-6/T=300K/P=1atm/L=100cm":         false,
+	} {
+		c := want
+		c.NuStart, c.NuEnd = intervals[0][0], intervals[0][1]
+		line := syntheticSpectrum(c)
+		line.Conditions = label
+		records, conditions := readTestZip(t, []plotLine{line})
+		err := checkSpectra(records, conditions, want, intervals)
+		if match && err != nil {
+			t.Errorf("%s: expected spectra to match. %s", label, err)
+		} else if !match && !errors.Is(err, ErrConditionMismatch) {
+			t.Errorf("%s: expected ErrConditionMismatch, got %v", label, err)
+		}
+	}
+}
+
+// readTestZip writes lines to a zip as spectraplot would and reads it back.
+func readTestZip(t *testing.T, lines []plotLine) ([]spectra, []string) {
+	t.Helper()
+	zipName := t.TempDir() + fpsep + defaultZipName
+	fo, err := os.Create(zipName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeSpectraZip(fo, lines)
+	fo.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, conditions, err := readSpectraZip(zipName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records, conditions
+}
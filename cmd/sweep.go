@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// maxSweepValues limits the values a single range sweep may expand to.
+const maxSweepValues = 10000
+
+// sweepValues returns the values of a swept config key. The key may hold a
+// scalar (T: 300), a list (T: [250, 300, 350]) or an inclusive range
+// (T: {start: 250, end: 400, step: 25}).
+func sweepValues(key string) ([]float64, error) {
+	switch v := viper.Get(key).(type) {
+	case nil:
+		return []float64{0}, nil
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("%s: empty list", key)
+		}
+		values := make([]float64, len(v))
+		for i := range v {
+			f, err := cast.ToFloat64E(v[i])
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %s", key, i, err)
+			}
+			values[i] = f
+		}
+		return values, nil
+	case map[string]interface{}:
+		var start, end, step float64
+		for name, dst := range map[string]*float64{"start": &start, "end": &end, "step": &step} {
+			f, err := cast.ToFloat64E(v[name])
+			if err != nil || v[name] == nil {
+				return nil, fmt.Errorf("%s: range needs numeric start, end and step", key)
+			}
+			*dst = f
+		}
+		if step <= 0 || end < start {
+			return nil, fmt.Errorf("%s: range needs step > 0 and end >= start. got start=%g end=%g step=%g", key, start, end, step)
+		}
+		n := int(math.Floor((end-start)/step+1e-9)) + 1
+		if n > maxSweepValues {
+			return nil, fmt.Errorf("%s: range expands to %d values, more than %d", key, n, maxSweepValues)
+		}
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = start + float64(i)*step
+		}
+		return values, nil
+	default:
+		f, err := cast.ToFloat64E(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", key, err)
+		}
+		return []float64{f}, nil
+	}
+}
+
+// gasIDs returns the gases of HITRAN.gasID which may hold a single gas
+// (gasID: CH4), a comma separated list (gasID: CH4,H2O) or a list
+// (gasID: [CH4, H2O]). Gases are returned as species, i.e. CO2@HITEMP,
+// with HITRAN.database applied to gases given without @<database>.
+// A configured mixture replaces gasID and is returned by its mixture name.
+func gasIDs() ([]string, error) {
+	mix, err := configMixture()
+	if err != nil {
+		return nil, err
+	} else if mix != nil {
+		return []string{mixtureName(mix)}, nil
+	}
+	var raw []string
+	switch v := viper.Get(sectionKey("gasID")).(type) {
+	case nil:
+	case []interface{}, []string:
+		list, err := cast.ToStringSliceE(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", sectionKey("gasID"), err)
+		}
+		raw = list
+	default:
+		raw = strings.Split(cast.ToString(v), ",")
+	}
+	var gases []string
+	seen := make(map[string]bool)
+	for _, gas := range raw {
+		gas = strings.TrimSpace(gas)
+		if gas == "" {
+			continue
+		}
+		gasID, database := parseSpecies(gas)
+		if !strings.ContainsAny(gas, "@ ") {
+			database = defaultDatabase()
+		}
+		if err := checkSpecies(gasID, database); err != nil {
+			return nil, err
+		}
+		gas = spectraConditions{gasID: gasID, database: database}.species()
+		if seen[gas] {
+			continue
+		}
+		seen[gas] = true
+		gases = append(gases, gas)
+	}
+	if len(gases) == 0 {
+		return nil, fmt.Errorf("null HITRAN.gasID")
+	}
+	return gases, nil
+}
+
+// gasFloat returns the per gas override HITRAN.perGas.<species>.<key>,
+// HITRAN.perGas.<gasID>.<key> or fallback if neither is set.
+func gasFloat(species, key string, fallback float64) float64 {
+	gasID, _ := parseSpecies(species)
+	for _, gas := range []string{species, gasID} {
+		k := sectionKey("perGas." + gas + "." + key)
+		if viper.IsSet(k) {
+			return viper.GetFloat64(k)
+		}
+	}
+	return fallback
+}
+
+// gasMaxRange returns the widest interval calculated at once for species.
+func gasMaxRange(species string) float64 {
+	return gasFloat(species, "maxRange", viper.GetFloat64("spectraplot.maxRange"))
+}
+
+// crawlJobs returns the spectra conditions of every combination of the
+// gasID gases and the T, p, L and ppm sweeps of configSection, ordered by
+// gas. NIST.Telec is swept as well for NIST jobs and ppm is not swept for
+// mixtures, whose mole fractions are fixed. The wavenumber span is left unset.
+func crawlJobs() ([]spectraConditions, error) {
+	gases, err := gasIDs()
+	if err != nil {
+		return nil, err
+	}
+	mix, err := configMixture()
+	if err != nil {
+		return nil, err
+	}
+	var sweeps [5][]float64
+	for i, key := range []string{"T", "p", "L", "ppm", "Telec"} {
+		if (key == "Telec" && configSection != nistSection) || (key == "ppm" && mix != nil) {
+			sweeps[i] = []float64{0}
+			continue
+		}
+		values, err := sweepValues(sectionKey(key))
+		if err != nil {
+			return nil, err
+		}
+		sweeps[i] = values
+	}
+	var jobs []spectraConditions
+	for _, gas := range gases {
+		gasID, database := parseSpecies(gas)
+		for _, T := range sweeps[0] {
+			for _, P := range sweeps[1] {
+				for _, L := range sweeps[2] {
+					for _, ppm := range sweeps[3] {
+						for _, Telec := range sweeps[4] {
+							jobs = append(jobs, spectraConditions{
+								T:        T,
+								P:        P,
+								L:        L,
+								Ppm:      ppm,
+								Telec:    Telec,
+								NuStep:   gasFloat(gas, "stepNu", viper.GetFloat64(sectionKey("stepNu"))),
+								gasID:    gasID,
+								database: database,
+								mixture:  mix,
+							})
+						}
+					}
+				}
+			}
+		}
+	}
+	return jobs, nil
+}
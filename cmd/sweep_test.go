@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSweepValues(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("scalar", 300)
+	viper.Set("list", []interface{}{250, 300.5, "350"})
+	viper.Set("range", map[string]interface{}{"start": 250, "end": 400, "step": 25})
+	viper.Set("badrange", map[string]interface{}{"start": 400, "end": 250, "step": 25})
+	tests := map[string][]float64{
+		"scalar": {300},
+		"list":   {250, 300.5, 350},
+		"range":  {250, 275, 300, 325, 350, 375, 400},
+	}
+	for key, expected := range tests {
+		got, err := sweepValues(key)
+		if err != nil {
+			t.Errorf("%s: %s", key, err)
+			continue
+		}
+		if len(got) != len(expected) {
+			t.Errorf("%s: expected %v, got %v", key, expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Errorf("%s: expected %v, got %v", key, expected, got)
+				break
+			}
+		}
+	}
+	if _, err := sweepValues("badrange"); err == nil {
+		t.Error("expected error for range with end < start")
+	}
+}
+
+func TestCrawlSweep(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	viper.Set("HITRAN.T", []interface{}{250, 300})
+	viper.Set("HITRAN.p", map[string]interface{}{"start": 0.5, "end": 1, "step": 0.5})
+	viper.Set("HITRAN.endNu", 1300.0)
+	jobs, err := crawlJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 4 {
+		t.Fatalf("expected 4 jobs, got %d", len(jobs))
+	}
+	d := &fakeDriver{Dir: t.TempDir()}
+	if err = crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range jobs {
+		name := generateFilename(c, [2]float64{1000, 1300})
+		if _, err := os.Stat(outDir + fpsep + name); err != nil {
+			t.Errorf("expected output for %s. %s", conditionString(c), err)
+		}
+	}
+	// skip existing works per condition.
+	viper.Set("HITRAN.T", []interface{}{250, 300, 350})
+	d = &fakeDriver{Dir: t.TempDir()}
+	if err = crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Calculated) != 2*3 {
+		t.Errorf("expected only new T=350 jobs calculated, got %d calculations", len(d.Calculated))
+	}
+}
+
+func TestCrawlGases(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	viper.Set("HITRAN.gasID", []interface{}{"CH4", "H2O"})
+	viper.Set("HITRAN.perGas.H2O.maxRange", 300.0)
+	viper.Set("HITRAN.perGas.H2O.stepNu", 0.2)
+	d := &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// CH4 calculates 6 intervals of 100, H2O 2 intervals of 300.
+	if len(d.Calculated) != 6+2 {
+		t.Errorf("expected 8 calculations, got %d", len(d.Calculated))
+	}
+	ch4 := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CH4"}
+	h2o := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "H2O"}
+	for _, path := range []string{
+		outDir + fpsep + "CH4" + fpsep + generateFilename(ch4, [2]float64{1000, 1300}),
+		outDir + fpsep + "H2O" + fpsep + generateFilename(h2o, [2]float64{1000, 1600}),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected per gas output. %s", err)
+		}
+	}
+	jobs, err := crawlJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].NuStep != 0.1 || jobs[1].NuStep != 0.2 {
+		t.Errorf("expected per gas stepNu override, got %+v", jobs)
+	}
+}
+
+func TestGasIDs(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("HITRAN.gasID", "CH4, H2O,CH4")
+	gases, err := gasIDs()
+	if err != nil || len(gases) != 2 || gases[0] != "CH4" || gases[1] != "H2O" {
+		t.Errorf("unexpected gases %v. %v", gases, err)
+	}
+	viper.Set("HITRAN.gasID", "")
+	if _, err = gasIDs(); err == nil {
+		t.Error("expected error for null gasID")
+	}
+}
+
+func TestCrawlHitemp(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	viper.Set("HITRAN.gasID", "CO2")
+	viper.Set("HITRAN.database", "hitemp")
+	d := &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Calculated) == 0 || d.Calculated[0].database != dbHITEMP {
+		t.Fatalf("expected HITEMP calculations, got %+v", d.Calculated)
+	}
+	c := spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, gasID: "CO2", database: dbHITEMP}
+	name := generateFilename(c, [2]float64{1000, 1300})
+	if name != "nu=1000-1300,CO2@HITEMP,x=1e-06,T=300K,P=1atm,L=100cm.csv" {
+		t.Errorf("unexpected filename %s", name)
+	}
+	b, err := os.ReadFile(outDir + fpsep + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "nu,CO2 HITEMP/") {
+		t.Errorf("expected database in header, got %.40q", b)
+	}
+	f, err := parseSpectraFilename(name)
+	if err != nil || f.conditions.gasID != "CO2" || f.conditions.database != dbHITEMP {
+		t.Errorf("unexpected parsed conditions %+v. %v", f.conditions, err)
+	}
+}
+
+func TestGasIDsDatabase(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("HITRAN.gasID", []interface{}{"CO2@hitemp", "CO2", "CH4@HITRAN"})
+	gases, err := gasIDs()
+	if err != nil || len(gases) != 3 || gases[0] != "CO2@HITEMP" || gases[1] != "CO2" || gases[2] != "CH4" {
+		t.Errorf("unexpected gases %v. %v", gases, err)
+	}
+	viper.Set("HITRAN.gasID", "CH4@HITEMP")
+	if _, err = gasIDs(); err == nil {
+		t.Error("expected error for gas missing in HITEMP")
+	}
+}
+
+func TestCrawlNist(t *testing.T) {
+	outDir := setCrawlConfig(t)
+	configSection = nistSection
+	t.Cleanup(func() { configSection = hitranSection })
+	for k, v := range map[string]interface{}{
+		"NIST.gasID":   []interface{}{"Na", "K+"},
+		"NIST.Telec":   []interface{}{1000.0, 2000.0},
+		"NIST.T":       300.0,
+		"NIST.p":       1.0,
+		"NIST.L":       1.0,
+		"NIST.ppm":     0.1,
+		"NIST.startNu": 16900.0,
+		"NIST.endNu":   17100.0,
+		"NIST.stepNu":  0.01,
+	} {
+		viper.Set(k, v)
+	}
+	jobs, err := crawlJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 4 || jobs[0].database != dbNIST || jobs[3].gasID != "K+" || jobs[3].Telec != 2000 {
+		t.Fatalf("unexpected NIST jobs %+v", jobs)
+	}
+	d := &fakeDriver{Dir: t.TempDir()}
+	if err := crawl(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	c := spectraConditions{T: 300, P: 1, L: 1, Ppm: 0.1, Telec: 2000, gasID: "K+", database: dbNIST}
+	if _, err := os.Stat(outDir + fpsep + "K+@NIST" + fpsep + generateFilename(c, [2]float64{16900, 17100})); err != nil {
+		t.Errorf("expected NIST output. %s", err)
+	}
+	viper.Set("NIST.gasID", "CO2@HITEMP")
+	if _, err = gasIDs(); err == nil {
+		t.Error("expected error for molecule in NIST crawl")
+	}
+}
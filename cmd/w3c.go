@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	wd "github.com/fedesog/webdriver"
+	"github.com/spf13/viper"
+)
+
+// w3cElementKey identifies element references in W3C WebDriver responses.
+const w3cElementKey = "element-6066-11e4-a52e-4f735466cecf"
+
+// w3cSession is a browserSession on a remote W3C WebDriver endpoint such as
+// a Selenium Grid or a browser container. ChromeDriver sessions only speak
+// to the local driver they start so remote sessions need their own client.
+type w3cSession struct {
+	client *http.Client
+	// url is the session's endpoint, i.e. http://grid:4444/session/<id>.
+	url string
+}
+
+type w3cElement struct {
+	s  *w3cSession
+	id string
+}
+
+// newW3CSession opens a session with capabilities caps on the WebDriver
+// endpoint remoteURL.
+func newW3CSession(remoteURL string, caps wd.Capabilities) (*w3cSession, error) {
+	s := &w3cSession{client: &http.Client{Timeout: time.Minute}, url: strings.TrimSuffix(remoteURL, "/")}
+	var session struct {
+		SessionID string `json:"sessionId"`
+	}
+	err := s.do(http.MethodPost, "/session", map[string]interface{}{
+		"capabilities": map[string]interface{}{"alwaysMatch": caps},
+	}, &session)
+	if err != nil {
+		return nil, fmt.Errorf("new session on %s: %s", remoteURL, err)
+	}
+	s.url += "/session/" + session.SessionID
+	return s, nil
+}
+
+// w3cCapabilities returns the capabilities of browser.type for W3C sessions,
+// which name the browser and take vendor prefixed options.
+func w3cCapabilities(downloadDir string) (wd.Capabilities, error) {
+	if viper.GetString("browser.type") == browserFirefox {
+		return firefoxCapabilities(downloadDir)
+	}
+	caps, err := chromeCapabilities(downloadDir)
+	if err != nil {
+		return nil, err
+	}
+	caps["goog:chromeOptions"] = caps["chromeOptions"]
+	delete(caps, "chromeOptions")
+	if caps["browserName"] == nil {
+		caps["browserName"] = browserChrome
+	}
+	return caps, nil
+}
+
+// do sends a command to path relative to s.url and decodes the value of
+// the response into result if not nil.
+func (s *w3cSession) do(method, path string, body, result interface{}) error {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, s.url+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	var werr struct{ Error, Message string }
+	if resp.StatusCode != http.StatusOK {
+		_ = json.Unmarshal(reply.Value, &werr)
+		return fmt.Errorf("%s %s: %s. %s", method, path, werr.Error, werr.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Value, result)
+}
+
+func (s *w3cSession) Url(pageURL string) error {
+	return s.do(http.MethodPost, "/url", map[string]string{"url": pageURL}, nil)
+}
+
+func (s *w3cSession) FindElement(using wd.FindElementStrategy, value string) (pageElement, error) {
+	var ref map[string]string
+	err := s.do(http.MethodPost, "/element", map[string]string{"using": string(using), "value": value}, &ref)
+	if err != nil {
+		return nil, err
+	}
+	return w3cElement{s: s, id: ref[w3cElementKey]}, nil
+}
+
+func (s *w3cSession) FindElements(using wd.FindElementStrategy, value string) ([]pageElement, error) {
+	return s.findElements("", using, value)
+}
+
+// findElements finds elements within the element of path, the whole page
+// if empty.
+func (s *w3cSession) findElements(path string, using wd.FindElementStrategy, value string) ([]pageElement, error) {
+	var refs []map[string]string
+	err := s.do(http.MethodPost, path+"/elements", map[string]string{"using": string(using), "value": value}, &refs)
+	if err != nil {
+		return nil, err
+	}
+	elems := make([]pageElement, len(refs))
+	for i, ref := range refs {
+		elems[i] = w3cElement{s: s, id: ref[w3cElementKey]}
+	}
+	return elems, nil
+}
+
+func (s *w3cSession) CloseCurrentWindow() error { return s.do(http.MethodDelete, "/window", nil, nil) }
+
+func (s *w3cSession) Delete() error { return s.do(http.MethodDelete, "", nil, nil) }
+
+func (e w3cElement) path() string { return "/element/" + url.PathEscape(e.id) }
+
+func (e w3cElement) FindElements(using wd.FindElementStrategy, value string) ([]pageElement, error) {
+	return e.s.findElements(e.path(), using, value)
+}
+
+func (e w3cElement) Click() error {
+	return e.s.do(http.MethodPost, e.path()+"/click", struct{}{}, nil)
+}
+
+func (e w3cElement) Text() (text string, err error) {
+	err = e.s.do(http.MethodGet, e.path()+"/text", nil, &text)
+	return text, err
+}
+
+func (e w3cElement) Clear() error {
+	return e.s.do(http.MethodPost, e.path()+"/clear", struct{}{}, nil)
+}
+
+func (e w3cElement) SendKeys(sequence string) error {
+	return e.s.do(http.MethodPost, e.path()+"/value", map[string]string{"text": sequence}, nil)
+}
+
+// GetAttribute returns attribute name of the element. The value of inputs is
+// read from their property since the W3C attribute holds the initial value.
+func (e w3cElement) GetAttribute(name string) (string, error) {
+	kind := "/attribute/"
+	if name == "value" {
+		kind = "/property/"
+	}
+	var value interface{}
+	if err := e.s.do(http.MethodGet, e.path()+kind+name, nil, &value); err != nil {
+		return "", err
+	}
+	if value == nil {
+		return "", nil
+	}
+	return fmt.Sprint(value), nil
+}
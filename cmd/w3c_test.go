@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// fakeW3C is a W3C WebDriver endpoint serving a page whose elements are
+// looked up by CSS selector. It records the text sent to each element.
+type fakeW3C struct {
+	// values holds the value property of elements by selector.
+	values map[string]string
+	// sent holds the text typed into elements by selector.
+	sent map[string]string
+	caps map[string]interface{}
+}
+
+func (f *fakeW3C) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(status int, value interface{}) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"value": value})
+	}
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	path := strings.TrimPrefix(r.URL.Path, "/wd/hub")
+	if path == "/session" {
+		f.caps, _ = body["capabilities"].(map[string]interface{})["alwaysMatch"].(map[string]interface{})
+		reply(http.StatusOK, map[string]string{"sessionId": "s1"})
+		return
+	}
+	path = strings.TrimPrefix(path, "/session/s1")
+	switch {
+	case path == "/element":
+		sel := body["value"].(string)
+		if _, ok := f.values[sel]; !ok {
+			reply(http.StatusNotFound, map[string]string{"error": "no such element", "message": sel})
+			return
+		}
+		reply(http.StatusOK, map[string]string{w3cElementKey: sel})
+	case strings.HasSuffix(path, "/property/value"):
+		sel := strings.TrimSuffix(strings.TrimPrefix(path, "/element/"), "/property/value")
+		reply(http.StatusOK, f.values[sel])
+	case strings.HasSuffix(path, "/value"):
+		sel := strings.TrimSuffix(strings.TrimPrefix(path, "/element/"), "/value")
+		f.sent[sel] = body["text"].(string)
+		f.values[sel] = body["text"].(string)
+		reply(http.StatusOK, nil)
+	case strings.HasSuffix(path, "/clear"), strings.HasSuffix(path, "/click"), path == "/url",
+		path == "/window", path == "":
+		reply(http.StatusOK, nil)
+	default:
+		reply(http.StatusNotFound, map[string]string{"error": "unknown command", "message": path})
+	}
+}
+
+func TestW3CSession(t *testing.T) {
+	f := &fakeW3C{values: map[string]string{"#T": ""}, sent: map[string]string{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	t.Cleanup(viper.Reset)
+	viper.Set("browser.headless", true)
+	caps, err := w3cCapabilities("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newW3CSession(srv.URL+"/wd/hub/", caps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.caps["browserName"] != "chrome" || f.caps["goog:chromeOptions"] == nil {
+		t.Errorf("expected chrome capabilities with goog:chromeOptions, got %v", f.caps)
+	}
+	if err = fillForm(s, []formField{{"#T", "%.3f", 300}}); err != nil {
+		t.Fatal(err)
+	}
+	if f.sent["#T"] != "300.000" {
+		t.Errorf("expected 300.000 typed into #T, got %q", f.sent["#T"])
+	}
+	if _, err = query(s, "#missing"); err == nil || !strings.Contains(err.Error(), "no such element") {
+		t.Errorf("expected no such element error, got %v", err)
+	}
+	if err = s.Delete(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestW3CCaptureExport(t *testing.T) {
+	line := syntheticSpectrum(spectraConditions{T: 300, P: 1, L: 100, Ppm: 1, NuStart: 6200, NuEnd: 6210, NuStep: 0.5, gasID: "CH4"})
+	points := make([]map[string]float64, len(line.Nu))
+	for i := range line.Nu {
+		points[i] = map[string]float64{"abs": line.Abs[i], "nu": line.Nu[i]}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"line0": points})
+	f := &fakeW3C{values: map[string]string{
+		selector("data"):             "",
+		selector("exportData"):       string(data),
+		selector("exportConditions"): line.Conditions,
+	}, sent: map[string]string{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	s, err := newW3CSession(srv.URL, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &webDriver{s: s, downloadDir: t.TempDir()}
+	zipName, err := d.Download(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, conditions, err := readSpectraZip(zipName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || strings.Join(conditions, "/") != line.Conditions {
+		t.Errorf("expected captured spectrum %s, got %d spectra with %v", line.Conditions, len(records), conditions)
+	}
+}
+
+func TestFirefoxCapabilities(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("browser.type", browserFirefox)
+	viper.Set("browser.headless", true)
+	viper.Set("browser.capabilities", map[string]interface{}{
+		"moz:firefoxoptions": map[string]interface{}{"args": []interface{}{"-safe-mode"}},
+	})
+	caps, err := w3cCapabilities("/tmp/dl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps["browserName"] != browserFirefox {
+		t.Errorf("expected firefox browserName, got %v", caps["browserName"])
+	}
+	options := caps["moz:firefoxOptions"].(map[string]interface{})
+	if args := strings.Join(options["args"].([]string), " "); args != "-safe-mode -headless" {
+		t.Errorf("unexpected args %q", args)
+	}
+	prefs := options["prefs"].(map[string]interface{})
+	if prefs["browser.download.dir"] != "/tmp/dl" || prefs["browser.download.folderList"] != 2 {
+		t.Errorf("unexpected download prefs %v", prefs)
+	}
+}
@@ -1,12 +1,403 @@
 package cmd
 
-import wd "github.com/fedesog/webdriver"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
-func query(s *wd.Session, querySelector string) (wd.WebElement, error) {
+	wd "github.com/fedesog/webdriver"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// webDriver is a SpectraplotDriver backed by a ChromeDriver or geckodriver
+// session, or by a remote WebDriver session when browser.remoteURL is set.
+type webDriver struct {
+	// driver is the local driver process, nil for remote sessions.
+	driver interface {
+		Stop() error
+	}
+	s           browserSession
+	downloadDir string
+	// tempDir is set when downloadDir is owned by the driver.
+	tempDir bool
+	// calcButton selects the calculate button of the tab last filled in.
+	calcButton string
+}
+
+// newWebDriver starts the driver of browser.type and opens spectraplot.url
+// in a new session. Workers other than the first get their own driver port
+// and, when running several workers, their own download directory so
+// downloads do not collide. Without browser.downloadDir the browser
+// downloads into a temporary directory removed on Close. With
+// browser.remoteURL the session is opened on that WebDriver endpoint
+// instead of a local driver.
+func newWebDriver(worker int) (d *webDriver, err error) {
+	d = &webDriver{downloadDir: viper.GetString("browser.downloadDir")}
+	if d.downloadDir == "" {
+		if d.downloadDir, err = os.MkdirTemp("", "spectracrawl"); err != nil {
+			return nil, err
+		}
+		d.tempDir = true
+	} else if viper.GetInt("browser.workers") > 1 {
+		d.downloadDir = fmt.Sprintf("%s%sworker%d", d.downloadDir, fpsep, worker+1)
+		if err = os.MkdirAll(d.downloadDir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		if err != nil && d.tempDir {
+			_ = os.RemoveAll(d.downloadDir)
+		}
+	}()
+	if d.downloadDir, err = filepath.Abs(d.downloadDir); err != nil {
+		return nil, err
+	}
+	remoteURL := viper.GetString("browser.remoteURL")
+	switch {
+	case remoteURL != "":
+		// downloads land on the remote node so they are captured from the page.
+		desired, err := w3cCapabilities("")
+		if err != nil {
+			return nil, err
+		}
+		if d.s, err = newW3CSession(remoteURL, desired); err != nil {
+			return nil, err
+		}
+	case viper.GetString("browser.type") == browserFirefox:
+		desired, err := firefoxCapabilities(d.downloadDir)
+		if err != nil {
+			return nil, err
+		}
+		gecko, err := startGeckoDriver(viper.GetString("browser.driverPath"), geckoDriverPort+worker)
+		if err != nil {
+			return nil, err
+		}
+		if d.s, err = newW3CSession(gecko.url, desired); err != nil {
+			_ = gecko.Stop()
+			return nil, err
+		}
+		d.driver = gecko
+	default:
+		desired, err := chromeCapabilities(d.downloadDir)
+		if err != nil {
+			return nil, err
+		}
+		chromeDriver := wd.NewChromeDriver(viper.GetString("browser.driverPath"))
+		chromeDriver.Port += worker
+		if err = chromeDriver.Start(); err != nil {
+			return nil, err
+		}
+		session, err := chromeDriver.NewSession(desired, wd.Capabilities{})
+		if err != nil {
+			_ = chromeDriver.Stop()
+			return nil, err
+		}
+		d.driver, d.s = chromeDriver, chromeSession{session}
+	}
+	_ = os.Remove(d.zipName()) // delete any previous spectraplot file if present
+	if err = d.Reload(); err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// chromeCapabilities returns browser.capabilities with chromeOptions set
+// from browser.headless, browser.args and browser.binary, downloading into
+// downloadDir without prompting unless it is empty.
+func chromeCapabilities(downloadDir string) (wd.Capabilities, error) {
+	// the new headless mode is the one that saves downloads.
+	caps, options, err := configCapabilities("chromeOptions", "--headless=new", "--disable-gpu")
+	if err != nil {
+		return nil, err
+	}
+	if downloadDir != "" {
+		prefs := copyMap(cast.ToStringMap(options["prefs"]))
+		prefs["download.default_directory"] = downloadDir
+		prefs["download.prompt_for_download"] = false
+		options["prefs"] = prefs
+	}
+	caps["chromeOptions"] = options
+	return caps, nil
+}
+
+// configCapabilities returns browser.capabilities and a copy of the browser
+// options held under optionsKey with args and binary set from browser.args,
+// browser.binary and, if browser.headless is set, headlessArgs. The config
+// loader lowercases map keys so capabilities may be given as a JSON string
+// to keep their case. optionsKey is matched ignoring case.
+func configCapabilities(optionsKey string, headlessArgs ...string) (wd.Capabilities, map[string]interface{}, error) {
+	caps := wd.Capabilities{}
+	if js, ok := viper.Get("browser.capabilities").(string); ok && js != "" {
+		if err := json.Unmarshal([]byte(js), &caps); err != nil {
+			return nil, nil, fmt.Errorf("browser.capabilities: %s", err)
+		}
+	} else {
+		for k, v := range viper.GetStringMap("browser.capabilities") {
+			caps[k] = v
+		}
+	}
+	for k := range caps {
+		if k != optionsKey && strings.EqualFold(k, optionsKey) {
+			caps[optionsKey] = caps[k]
+			delete(caps, k)
+		}
+	}
+	// copy nested values so config values are not modified.
+	options := copyMap(cast.ToStringMap(caps[optionsKey]))
+	args := append([]string{}, cast.ToStringSlice(options["args"])...)
+	args = append(args, viper.GetStringSlice("browser.args")...)
+	if viper.GetBool("browser.headless") {
+		args = append(args, headlessArgs...)
+	}
+	if len(args) > 0 {
+		options["args"] = args
+	}
+	if binary := viper.GetString("browser.binary"); binary != "" {
+		options["binary"] = binary
+	}
+	return caps, options, nil
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// startWebDrivers starts browser.workers browser sessions.
+func startWebDrivers() ([]SpectraplotDriver, error) {
+	var drivers []SpectraplotDriver
+	for i := 0; i < viper.GetInt("browser.workers"); i++ {
+		d, err := newWebDriver(i)
+		if err != nil {
+			closeDrivers(drivers)
+			return nil, err
+		}
+		drivers = append(drivers, d)
+	}
+	if len(drivers) == 0 {
+		return nil, fmt.Errorf("no browser workers configured")
+	}
+	logf("[inf] started %d browser sessions", len(drivers))
+	return drivers, nil
+}
+
+func closeDrivers(drivers []SpectraplotDriver) {
+	for _, d := range drivers {
+		if err := d.Close(); err != nil {
+			logf("[warn] closing browser session. %s", err)
+		}
+	}
+}
+
+func (d *webDriver) zipName() string { return d.downloadDir + fpsep + defaultZipName }
+
+func (d *webDriver) SetConditions(c spectraConditions) error {
+	if c.database == dbNIST {
+		d.calcButton = selector("nistCalculate")
+		return setNist(d.s, c)
+	}
+	d.calcButton = selector("hitranCalculate")
+	return setHitran(d.s, c)
+}
+
+func (d *webDriver) SelectSpecies(slot int, gasID, database string) error {
+	if database == dbNIST {
+		return selectNistSpecies(d.s, slot, gasID)
+	}
+	return selectSpecies(d.s, slot, gasID, database)
+}
+
+func (d *webDriver) Calculate(ctx context.Context) error {
+	_ = leftClickSelector(d.s, d.calcButton)
+	return waitForCalculation(ctx, d.s, d.calcButton)
+}
+
+func (d *webDriver) Download(ctx context.Context) (string, error) {
+	_ = leftClickSelector(d.s, selector("data"))
+	if d.driver == nil {
+		return d.zipName(), d.captureExport()
+	}
+	return d.zipName(), waitForDownload(ctx, d.zipName())
+}
+
+// captureExport writes the plots held by the export form, filled in when
+// clicking the data button, to the zip the page would download. Downloads
+// of remote browsers land on the remote node so they are not waited on.
+func (d *webDriver) captureExport() error {
+	var values [2]string
+	for i, name := range []string{"exportData", "exportConditions"} {
+		elem, err := query(d.s, selector(name))
+		if err != nil {
+			return ErrPageScan
+		}
+		if values[i], err = elem.GetAttribute("value"); err != nil {
+			return err
+		}
+	}
+	lines, err := parseExportForm(values[0], values[1])
+	if err != nil {
+		return err
+	}
+	fo, err := os.Create(d.zipName())
+	if err != nil {
+		return err
+	}
+	defer fo.Close()
+	return writeSpectraZip(fo, lines)
+}
+
+func (d *webDriver) Clear() error { return leftClickSelector(d.s, selector("clear")) }
+
+func (d *webDriver) Reload() error { return d.s.Url(viper.GetString("spectraplot.url")) }
+
+func (d *webDriver) Close() error {
+	_ = d.s.CloseCurrentWindow()
+	err := d.s.Delete()
+	if d.driver != nil {
+		if stopErr := d.driver.Stop(); err == nil {
+			err = stopErr
+		}
+	}
+	if d.tempDir {
+		if rmErr := os.RemoveAll(d.downloadDir); err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
+
+// browserSession is the part of a WebDriver session the page is driven
+// with. It is implemented by ChromeDriver sessions and remote W3C sessions.
+type browserSession interface {
+	Url(url string) error
+	FindElement(using wd.FindElementStrategy, value string) (pageElement, error)
+	FindElements(using wd.FindElementStrategy, value string) ([]pageElement, error)
+	CloseCurrentWindow() error
+	Delete() error
+}
+
+// pageElement is an element found in a browserSession.
+type pageElement interface {
+	FindElements(using wd.FindElementStrategy, value string) ([]pageElement, error)
+	Click() error
+	Text() (string, error)
+	Clear() error
+	SendKeys(sequence string) error
+	// GetAttribute returns the current value of name, i.e. the text typed
+	// into an input for "value".
+	GetAttribute(name string) (string, error)
+}
+
+// chromeSession adapts a ChromeDriver session to browserSession.
+type chromeSession struct{ *wd.Session }
+
+func (s chromeSession) FindElement(using wd.FindElementStrategy, value string) (pageElement, error) {
+	e, err := s.Session.FindElement(using, value)
+	if err != nil {
+		return nil, err
+	}
+	return chromeElement{e}, nil
+}
+
+func (s chromeSession) FindElements(using wd.FindElementStrategy, value string) ([]pageElement, error) {
+	elems, err := s.Session.FindElements(using, value)
+	return chromeElements(elems), err
+}
+
+type chromeElement struct{ wd.WebElement }
+
+func (e chromeElement) FindElements(using wd.FindElementStrategy, value string) ([]pageElement, error) {
+	elems, err := e.WebElement.FindElements(using, value)
+	return chromeElements(elems), err
+}
+
+func chromeElements(elems []wd.WebElement) []pageElement {
+	page := make([]pageElement, len(elems))
+	for i, e := range elems {
+		page[i] = chromeElement{e}
+	}
+	return page
+}
+
+func query(s browserSession, querySelector string) (pageElement, error) {
 	return s.FindElement("css selector", querySelector)
 }
 
-func leftClickSelector(s *wd.Session, querySelector string) error {
+// formField is a form input and the value typed into it with format.
+type formField struct {
+	selector, format string
+	value            float64
+}
+
+// fillForm clears each field's input, types its value in and reads it back.
+// Returns ErrFormMismatch if an input does not hold the value typed in.
+func fillForm(s browserSession, fields []formField) error {
+	for _, field := range fields {
+		elem, err := query(s, field.selector)
+		if err != nil {
+			return ErrPageScan
+		}
+		if err = elem.Clear(); err != nil {
+			return err
+		}
+		if err = elem.SendKeys(fmt.Sprintf(field.format, field.value)); err != nil {
+			return err
+		}
+		got, err := elem.GetAttribute("value")
+		if err != nil {
+			return err
+		}
+		if !sameFormValue(field.format, field.value, got) {
+			logf("[warn] %s holds %q. expected %s", field.selector, got, fmt.Sprintf(field.format, field.value))
+			return ErrFormMismatch
+		}
+	}
+	return nil
+}
+
+// sameFormValue reports whether the text got of a form input equals want
+// to the precision of format.
+func sameFormValue(format string, want float64, got string) bool {
+	f, err := strconv.ParseFloat(strings.TrimSpace(got), 64)
+	return err == nil && fmt.Sprintf(format, f) == fmt.Sprintf(format, want)
+}
+
+// checkSpeciesLabel returns ErrFormMismatch if the species label selected
+// by label does not show gasID. The database is only checked when the
+// label shows one since spectraplot may hide it.
+func checkSpeciesLabel(s browserSession, label, gasID, database string) error {
+	elem, err := query(s, label)
+	if err != nil {
+		return ErrPageScan
+	}
+	text, err := elem.Text()
+	if err != nil {
+		return err
+	}
+	if !speciesLabelMatches(text, gasID, database) {
+		logf("[warn] %s shows %q. expected %s", label, text, spectraConditions{gasID: gasID, database: database}.species())
+		return ErrFormMismatch
+	}
+	return nil
+}
+
+// speciesLabelMatches reports whether a species label such as "CO2 HITEMP"
+// shows gasID of database.
+func speciesLabelMatches(text, gasID, database string) bool {
+	gotGas, gotDatabase := parseSpecies(text)
+	return gotGas == gasID && (gotDatabase == "" || gotDatabase == database)
+}
+
+func leftClickSelector(s browserSession, querySelector string) error {
 	//var m wd.MouseButton = 0 // left click
 	elem, err := query(s, querySelector) // button selector
 	if err != nil {
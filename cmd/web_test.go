@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestSameFormValue(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		want   float64
+		got    string
+		same   bool
+	}{
+		{"%.3f", 300, "300.000", true},
+		{"%.3f", 300, " 300 ", true},
+		{"%.3f", 1000.0004, "1000.000", true},
+		{"%.3f", 1000, "1000.01", false},
+		{"%.3e", 1e-6, "1.000e-06", true},
+		{"%.3e", 1e-6, "1e-3", false},
+		{"%.3f", 300, "", false},
+	} {
+		if same := sameFormValue(test.format, test.want, test.got); same != test.same {
+			t.Errorf("sameFormValue(%q, %g, %q) = %v", test.format, test.want, test.got, same)
+		}
+	}
+}
+
+func TestSpeciesLabelMatches(t *testing.T) {
+	for _, test := range []struct {
+		text, gasID, database string
+		match                 bool
+	}{
+		{"CO2", "CO2", "", true},
+		{"CO2 HITEMP", "CO2", dbHITEMP, true},
+		{"CO2", "CO2", dbHITEMP, true}, // database span hidden
+		{"CO2 HITEMP", "CO2", "", false},
+		{"CO", "CO2", "", false},
+		{"Species", "CH4", "", false},
+	} {
+		if match := speciesLabelMatches(test.text, test.gasID, test.database); match != test.match {
+			t.Errorf("speciesLabelMatches(%q, %s, %q) = %v", test.text, test.gasID, test.database, match)
+		}
+	}
+}
+
+func TestChromeCapabilities(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("browser.headless", true)
+	viper.Set("browser.args", []string{"--no-sandbox"})
+	viper.Set("browser.binary", "/usr/bin/chromium")
+	viper.Set("browser.capabilities", map[string]interface{}{
+		"platform":      "LINUX",
+		"chromeoptions": map[string]interface{}{"args": []interface{}{"--lang=en"}},
+	})
+	for i := 0; i < 2; i++ { // config must not accumulate flags.
+		caps, err := chromeCapabilities("/tmp/dl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if caps["platform"] != "LINUX" {
+			t.Errorf("expected platform capability, got %v", caps)
+		}
+		options := caps["chromeOptions"].(map[string]interface{})
+		args := strings.Join(options["args"].([]string), " ")
+		if args != "--lang=en --no-sandbox --headless=new --disable-gpu" {
+			t.Errorf("unexpected args %q", args)
+		}
+		if options["binary"] != "/usr/bin/chromium" {
+			t.Errorf("unexpected binary %v", options["binary"])
+		}
+		prefs := options["prefs"].(map[string]interface{})
+		if prefs["download.default_directory"] != "/tmp/dl" {
+			t.Errorf("unexpected download directory %v", prefs["download.default_directory"])
+		}
+	}
+	viper.Set("browser.capabilities", `{"acceptInsecureCerts": true}`)
+	caps, err := chromeCapabilities("/tmp/dl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps["acceptInsecureCerts"] != true {
+		t.Errorf("expected JSON capabilities to keep their case, got %v", caps)
+	}
+}
+
+func TestCalculationState(t *testing.T) {
+	for text, want := range map[string]bool{
+		"Calculating...": true,
+		" Calculating… ": true,
+		"Calculate":      false,
+		"":               false,
+	} {
+		if got := calculating(text); got != want {
+			t.Errorf("calculating(%q) = %v", text, got)
+		}
+	}
+	for style, want := range map[string]bool{
+		"display: block;": true,
+		"display:block":   true,
+		"display: none;":  false,
+		"":                false,
+	} {
+		if got := alertShown(style); got != want {
+			t.Errorf("alertShown(%q) = %v", style, got)
+		}
+	}
+}
+
+func TestWaitForDownload(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("output.timeout_s", 5)
+	name := filepath.Join(t.TempDir(), defaultZipName)
+	// Firefox creates an empty placeholder next to the partial download.
+	for _, placeholder := range []string{name, name + ".part"} {
+		if err := os.WriteFile(placeholder, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	written := make(chan error, 1)
+	go func() {
+		time.Sleep(3 * pollInterval)
+		err := os.WriteFile(name, []byte("PK"), 0644)
+		if err == nil {
+			err = os.Remove(name + ".part")
+		}
+		written <- err
+	}()
+	if err := waitForDownload(context.Background(), name); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatal("expected wait until the partial download is gone")
+	}
+	if fi, err := os.Stat(name); err != nil || fi.Size() == 0 {
+		t.Errorf("expected written download, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// worker is a browser session crawling batches off the work queue.
+type worker struct {
+	id      int
+	d       SpectraplotDriver
+	limiter *rateLimiter
+	// sizer adapts interval widths to calculations, nil if not adaptive.
+	sizer *intervalSizer
+	// attempt is the attempt at the batch being crawled.
+	attempt int
+}
+
+// logf logs at the level of tag, i.e. "scp", with the worker id as a field.
+func (w *worker) logf(tag, format string, args ...interface{}) {
+	logEvent(logLevels[tag], fmt.Sprintf(format, args...), "worker", w.id)
+}
+
+// logJob logs a job event of the worker over interval of the crawl of c
+// taking d, followed by key-value pairs args.
+func (w *worker) logJob(tag, msg string, c spectraConditions, interval [2]float64, d time.Duration, args ...interface{}) {
+	fields := append([]interface{}{"worker", w.id}, jobFields(c, interval, w.attempt, d)...)
+	logEvent(logLevels[tag], msg, append(fields, args...)...)
+}
+
+// queuedBatch is a batch of contiguous intervals on the work queue.
+type queuedBatch struct {
+	intervals [][2]float64
+	// attempt is one more than the most attempts of any of intervals.
+	attempt int
+}
+
+// batchResult is the outcome of makeFile for a batch of intervals.
+type batchResult struct {
+	worker    *worker
+	intervals [][2]float64
+	attempt   int
+	duration  time.Duration
+	file      string
+	calcErrs  []error
+	err       error
+}
+
+// rateLimiter spaces out events shared among goroutines by at least every.
+type rateLimiter struct {
+	mu    sync.Mutex
+	every time.Duration
+	next  time.Time
+}
+
+// wait blocks until the next event is allowed. Returns ctx.Err() if ctx
+// is done first.
+func (r *rateLimiter) wait(ctx context.Context) error {
+	if r == nil || r.every <= 0 {
+		return ctx.Err()
+	}
+	r.mu.Lock()
+	now := time.Now()
+	wait := r.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	r.next = now.Add(wait + r.every)
+	r.mu.Unlock()
+	return sleep(ctx, wait)
+}
+
+// sleep pauses for d or until ctx is done, in which case ctx.Err() is returned.
+func sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// pollInterval is the time between checks of poll.
+const pollInterval = 100 * time.Millisecond
+
+// poll calls done every pollInterval until it reports true or returns an
+// error. Returns ErrTimeout once timeout elapses and ctx.Err() if ctx is
+// done first.
+func poll(ctx context.Context, timeout time.Duration, done func() (bool, error)) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	tick := time.NewTicker(pollInterval)
+	defer tick.Stop()
+	for {
+		if ok, err := done(); ok || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return ErrTimeout
+		case <-tick.C:
+		}
+	}
+}